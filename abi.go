@@ -0,0 +1,484 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:generate go run . abi
+
+// templates/abi.json 描述插件与宿主之间的调用约定：每种插件导出的符号、参数布局与返回值编码。
+// 包装模板、C头文件与host包中的调用代码都由 builder abi 根据它生成
+//
+//go:embed templates/abi.json
+var abiSpecJson []byte
+
+var abi = mustLoadAbiSpec()
+
+type abiSpec struct {
+	Version int `json:"version"`
+	Exports struct {
+		Wrapper      string `json:"wrapper"`       // 函数模式下的包装函数
+		NewInstance  string `json:"new_instance"`  // 实例模式下创建实例
+		Call         string `json:"call"`          // 实例模式下调用实例
+		FreeInstance string `json:"free_instance"` // 实例模式下释放实例
+		Metadata     string `json:"metadata"`      // 插件元数据
+	} `json:"exports"`
+	Encodings map[string]string `json:"encodings"` // 编码方式的说明
+	Plugins   []*abiPlugin      `json:"plugins"`
+}
+
+// abiPlugin 单个插件类型的调用约定
+type abiPlugin struct {
+	Type        string      `json:"type"`        // 模板类型，如reactor
+	Function    string      `json:"function"`    // 插件函数名
+	Constructor string      `json:"constructor"` // 实例模式下的构造函数名
+	HostMethod  string      `json:"host_method"` // host.Caller上对应的方法名
+	Inputs      []*abiInput `json:"inputs"`      // 插件函数的固定参数，自定义参数紧随其后
+	Result      struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+	} `json:"result"`
+}
+
+type abiInput struct {
+	Name     string `json:"name"`  // 包装函数与用例中使用的名字
+	Param    string `json:"param"` // 插件函数中的参数名
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+}
+
+func mustLoadAbiSpec() *abiSpec {
+	spec := new(abiSpec)
+	if err := json.Unmarshal(abiSpecJson, spec); err != nil {
+		panic(fmt.Sprintf("bad templates/abi.json: %v", err))
+	}
+	if err := spec.validate(); err != nil {
+		panic(fmt.Sprintf("bad templates/abi.json: %v", err))
+	}
+	return spec
+}
+
+// 根据模板类型查找调用约定
+func (spec *abiSpec) plugin(templateType string) *abiPlugin {
+	for _, p := range spec.Plugins {
+		if p.Type == templateType {
+			return p
+		}
+	}
+	return nil
+}
+
+// 插件函数签名示例，如 React(request *fuzzTypes.Req, resp *fuzzTypes.Resp, {custom arguments}) *fuzzTypes.Reaction
+func (p *abiPlugin) signature() string {
+	params := make([]string, 0, len(p.Inputs)+1)
+	for _, in := range p.Inputs {
+		params = append(params, in.Param+" "+in.Type)
+	}
+	params = append(params, "{custom arguments}")
+	return fmt.Sprintf("%s(%s) %s", p.Function, strings.Join(params, ", "), p.Result.Type)
+}
+
+// 首字母大写
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// 包装函数中固定参数的形参
+func (in *abiInput) wrapperParams() []string {
+	if in.Encoding == "json" {
+		return []string{in.Name + "Json *byte", in.Name + "JsonLen int"}
+	}
+	return []string{in.Name + " " + in.Type}
+}
+
+// runAbi 实现 builder abi：根据templates/abi.json重新生成包装模板、C头文件与host包中的调用代码。
+// 使用-check时只检查这些文件是否与规范一致
+func runAbi(args []string) {
+	fs := flag.NewFlagSet("abi", flag.ExitOnError)
+	root := fs.String("root", ".", "builder source root")
+	check := fs.Bool("check", false, "only check that generated files are up to date")
+	fs.Parse(args)
+	files := genAbiFiles(abi)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stale := 0
+	for _, name := range names {
+		path := filepath.Join(*root, name)
+		old, err := os.ReadFile(path)
+		if err == nil && string(old) == files[name] {
+			continue
+		}
+		if *check {
+			fmt.Printf("%s is out of date\n", name)
+			stale++
+			continue
+		}
+		if err = os.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Generated %s\n", name)
+	}
+	if stale > 0 {
+		fmt.Println("run \"go generate\" to regenerate them")
+		os.Exit(1)
+	}
+}
+
+// 生成的所有文件，键为相对于源码根目录的路径
+func genAbiFiles(spec *abiSpec) map[string]string {
+	files := map[string]string{
+		"host/abi_gen.go":       genHostStubs(spec),
+		"host/fuzzgiu_plugin.h": genCHeader(spec),
+	}
+	for _, p := range spec.Plugins {
+		files[getTemplateFileName(p.Type, false)] = genWrapperTemplate(spec, p, false)
+		files[getTemplateFileName(p.Type, true)] = genWrapperTemplate(spec, p, true)
+	}
+	return files
+}
+
+// 生成包装模板，模板中的占位符由wrapPlugin填写
+func genWrapperTemplate(spec *abiSpec, p *abiPlugin, instance bool) string {
+	imports := map[string]bool{"encoding/binary": true, "unsafe": true} // PluginMetadata使用
+	for _, in := range p.Inputs {
+		if in.Encoding == "json" {
+			imports["encoding/json"] = true
+		}
+	}
+	switch p.Result.Encoding {
+	case "json":
+		imports["encoding/json"] = true
+	case "stringList":
+		imports["bytes"] = true
+	}
+	if instance {
+		imports["sync"] = true
+		imports["sync/atomic"] = true
+	}
+	importList := make([]string, 0, len(imports))
+	for imp := range imports {
+		importList = append(importList, imp)
+	}
+	sort.Strings(importList)
+
+	sb := strings.Builder{}
+	sb.WriteString("package main\n\nimport \"C\"\nimport (\n")
+	for _, imp := range importList {
+		fmt.Fprintf(&sb, "\t%q\n", imp)
+	}
+	sb.WriteString(")\n/* CUSTOM IMPORTS */\n\n/* CODE */\n\n/* CONCURRENCY GUARD */\n\n")
+	fmt.Fprintf(&sb, `// 插件元数据（JSON），由构建器生成
+const pluginMetadataJson = "/* PLUGIN METADATA */"
+
+// 4字节长度前缀+元数据，保存在全局变量中，使%[1]s返回的指针始终有效
+var pluginMetadata = func() []byte {
+	ret := make([]byte, len(pluginMetadataJson)+4)
+	binary.LittleEndian.PutUint32(ret[0:4], uint32(len(pluginMetadataJson)))
+	copy(ret[4:], pluginMetadataJson)
+	return ret
+}()
+
+//export %[1]s
+func %[1]s() uintptr {
+	return uintptr(unsafe.Pointer(&pluginMetadata[0]))
+}
+
+`, spec.Exports.Metadata)
+
+	wrapperParams := make([]string, 0)
+	callee := p.Function
+	symbol := spec.Exports.Wrapper
+	if instance {
+		fmt.Fprintf(&sb, `/* INSTANCE TYPE */
+
+// 插件实例句柄表，句柄由%[1]s分配，由%[2]s释放，可被多个协程并发访问
+var (
+	instances      sync.Map
+	instanceHandle uint64
+)
+
+//export %[1]s
+func %[1]s( /* CONSTRUCTOR FORMAL PARAMETERS */ ) uintptr {
+	handle := uintptr(atomic.AddUint64(&instanceHandle, 1))
+	instances.Store(handle, %[3]s( /* CONSTRUCTOR ACTUAL PARAMETERS */ ))
+	return handle
+}
+
+//export %[2]s
+func %[2]s(handle uintptr) {
+	instances.Delete(handle)
+}
+
+// 根据句柄获取插件实例
+func getInstance(handle uintptr) (pluginInstance, bool) {
+	inst, ok := instances.Load(handle)
+	if !ok {
+		return nil, false
+	}
+	return inst.(pluginInstance), true
+}
+
+`, spec.Exports.NewInstance, spec.Exports.FreeInstance, p.Constructor)
+		wrapperParams = append(wrapperParams, "handle uintptr")
+		callee = "inst." + p.Function
+		symbol = spec.Exports.Call
+	}
+	callArgs := make([]string, 0, len(p.Inputs))
+	for _, in := range p.Inputs {
+		wrapperParams = append(wrapperParams, in.wrapperParams()...)
+		callArgs = append(callArgs, in.Name)
+	}
+	fmt.Fprintf(&sb, "//export %s\nfunc %s(%s) uintptr {\n\t/* ACQUIRE GUARD */\n",
+		symbol, symbol, strings.Join(append(wrapperParams, "/* FORMAL PARAMETERS */"), ", "))
+	if instance {
+		sb.WriteString("\tinst, ok := getInstance(handle)\n\tif !ok { // 无效句柄\n\t\treturn 0\n\t}\n")
+	}
+	for _, in := range p.Inputs {
+		if in.Encoding != "json" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\t%[1]s := new(%[2]s)\n\tjson.Unmarshal(unsafe.Slice(%[1]sJson, %[1]sJsonLen), %[1]s)\n",
+			in.Name, strings.TrimPrefix(in.Type, "*"))
+	}
+	fmt.Fprintf(&sb, "\tret := %s(%s)\n", callee, strings.Join(append(callArgs, "/* ACTUAL PARAMETERS */"), ", "))
+	if p.Result.Type == "*fuzzTypes.Resp" {
+		sb.WriteString(`	if ret != nil { // HttpResponse与ErrMsg不参与JSON编码，将其中的信息写入可以编码的字段
+		if r := ret.HttpResponse; r != nil && ret.StatusCode == 0 {
+			ret.StatusCode, ret.Proto, ret.Headers = r.StatusCode, r.Proto, r.Header
+		}
+		if ret.Error == "" {
+			ret.Error = ret.ErrMsg
+		}
+	}
+`)
+	}
+	switch p.Result.Encoding {
+	case "json":
+		sb.WriteString(`	retJson, _ := json.Marshal(ret)
+	buffer := make([]byte, len(retJson)+4)
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(len(retJson)))
+	copy(buffer[4:], retJson)
+	return uintptr(unsafe.Pointer(&buffer[0]))
+`)
+	case "string":
+		sb.WriteString(`	retHeap := make([]string, 0)
+	retHeap = append(retHeap, ret) // 欺骗编译器，将ret分配到堆中
+	return uintptr(unsafe.Pointer(&retHeap[0]))
+`)
+	case "stringList":
+		sb.WriteString(`	buffer := bytes.Buffer{}
+	binary.Write(&buffer, binary.LittleEndian, int32(len(ret))) // string切片的长度
+	for _, s := range ret {
+		binary.Write(&buffer, binary.LittleEndian, int32(len(s)))
+		buffer.WriteString(s)
+	}
+	return uintptr(unsafe.Pointer(&buffer.Bytes()[0]))
+`)
+	}
+	sb.WriteString("}\n\nfunc main() {}\n")
+	return sb.String()
+}
+
+// 生成host包中的调用代码：导出符号名与每种插件的调用方法
+func genHostStubs(spec *abiSpec) string {
+	sb := strings.Builder{}
+	sb.WriteString("// Code generated by \"builder abi\" from templates/abi.json. DO NOT EDIT.\n\npackage host\n\n")
+	sb.WriteString("import \"FuzzGIUPluginBuilder/fuzzTypes\"\n\n")
+	fmt.Fprintf(&sb, "// AbiVersion 调用约定的版本\nconst AbiVersion = %d\n\n", spec.Version)
+	fmt.Fprintf(&sb, "// 插件导出的符号\nconst (\n"+
+		"\tSymbolWrapper      = %q\n\tSymbolNewInstance  = %q\n\tSymbolCall         = %q\n"+
+		"\tSymbolFreeInstance = %q\n\tSymbolMetadata     = %q\n)\n",
+		spec.Exports.Wrapper, spec.Exports.NewInstance, spec.Exports.Call,
+		spec.Exports.FreeInstance, spec.Exports.Metadata)
+	for _, p := range spec.Plugins {
+		params := make([]string, 0, len(p.Inputs)+1)
+		for _, in := range p.Inputs {
+			params = append(params, in.Param+" "+in.Type)
+		}
+		params = append(params, "args ...interface{}")
+		zero := "nil"
+		if p.Result.Type == "string" {
+			zero = `""`
+		}
+		fmt.Fprintf(&sb, "\n// %s 调用%s插件，对应插件函数%s，args为自定义参数\n", p.HostMethod, p.Type, p.Function)
+		fmt.Fprintf(&sb, "func (c *Caller) %s(%s) (%s, error) {\n", p.HostMethod, strings.Join(params, ", "), p.Result.Type)
+		sb.WriteString("\tvar fixed []callArg\n\tvar err error\n")
+		for _, in := range p.Inputs {
+			switch in.Encoding {
+			case "json":
+				fmt.Fprintf(&sb, "\tif fixed, err = appendJsonArgs(fixed, %s); err != nil {\n\t\treturn %s, err\n\t}\n",
+					in.Param, zero)
+			case "string":
+				fmt.Fprintf(&sb, "\tfixed = append(fixed, stringArg(%s))\n", in.Param)
+			}
+		}
+		switch p.Result.Encoding {
+		case "json":
+			fmt.Fprintf(&sb, "\tresult := new(%s)\n\terr = c.call(fixed, args, decodeJson(result))\n",
+				strings.TrimPrefix(p.Result.Type, "*"))
+		case "string":
+			sb.WriteString("\tresult := \"\"\n\terr = c.call(fixed, args, func(ret uintptr) error {\n" +
+				"\t\tresult = readGoString(ret)\n\t\treturn nil\n\t})\n")
+		case "stringList":
+			sb.WriteString("\tvar result []string\n\terr = c.call(fixed, args, func(ret uintptr) error {\n" +
+				"\t\tresult = readStringList(ret)\n\t\treturn nil\n\t})\n")
+		}
+		sb.WriteString("\treturn result, err\n}\n")
+	}
+	return sb.String()
+}
+
+// C类型，与cgo为导出函数生成的类型布局一致
+var abiCTypes = map[string]string{
+	"*byte": "const uint8_t *",
+	"int":   "int64_t ",
+}
+
+// 生成供宿主使用的C头文件
+func genCHeader(spec *abiSpec) string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, `/* Code generated by "builder abi" from templates/abi.json. DO NOT EDIT. */
+
+/*
+ * FuzzGIU插件调用约定，版本 %d
+ * 函数模式下插件导出 %s(固定参数, 自定义参数)；
+ * 实例模式下插件导出 %s(构造参数) 返回句柄、%s(句柄, 固定参数, 自定义参数) 与 %s(句柄)。
+ * 所有插件导出 %s()，返回4字节小端长度前缀+JSON元数据。
+ * 自定义参数按Go类型传递：整数与bool占一个参数，string为FuzzGIUString。
+ * 返回值指向插件Go堆中的内存，宿主应在下一次调用前拷贝。
+ */
+#ifndef FUZZGIU_PLUGIN_H
+#define FUZZGIU_PLUGIN_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <string.h>
+
+#define FUZZGIU_ABI_VERSION %[1]d
+
+#define FUZZGIU_SYMBOL_WRAPPER "%[2]s"
+#define FUZZGIU_SYMBOL_NEW_INSTANCE "%[3]s"
+#define FUZZGIU_SYMBOL_CALL "%[4]s"
+#define FUZZGIU_SYMBOL_FREE_INSTANCE "%[5]s"
+#define FUZZGIU_SYMBOL_METADATA "%[6]s"
+
+/* 与cgo的GoString布局一致 */
+typedef struct {
+	const char *p;
+	ptrdiff_t n;
+} FuzzGIUString;
+
+/* 返回值编码 */
+`, spec.Version, spec.Exports.Wrapper, spec.Exports.NewInstance, spec.Exports.Call,
+		spec.Exports.FreeInstance, spec.Exports.Metadata)
+	encodings := make([]string, 0, len(spec.Encodings))
+	for name := range spec.Encodings {
+		encodings = append(encodings, name)
+	}
+	sort.Strings(encodings)
+	for i, name := range encodings {
+		fmt.Fprintf(&sb, "/* %s */\n#define FUZZGIU_ENCODING_%s %d\n", spec.Encodings[name], macroName(name), i+1)
+	}
+	for _, p := range spec.Plugins {
+		params := make([]string, 0)
+		for _, in := range p.Inputs {
+			for _, param := range in.wrapperParams() {
+				fields := strings.Fields(param)
+				cType, ok := abiCTypes[fields[1]]
+				if !ok {
+					cType = "FuzzGIUString "
+				}
+				params = append(params, cType+fields[0])
+			}
+		}
+		fmt.Fprintf(&sb, "\n/* %s: %s */\n", p.Type, p.signature())
+		if len(params) == 0 {
+			fmt.Fprintf(&sb, "#define FUZZGIU_%s_PARAMS\n", macroName(p.Type))
+		} else {
+			fmt.Fprintf(&sb, "#define FUZZGIU_%s_PARAMS %s\n", macroName(p.Type), strings.Join(params, ", "))
+		}
+		fmt.Fprintf(&sb, "#define FUZZGIU_%s_RESULT FUZZGIU_ENCODING_%s\n", macroName(p.Type), macroName(p.Result.Encoding))
+	}
+	sb.WriteString(`
+/* 解码json返回值，返回JSON数据并将长度写入len */
+static inline const char *fuzzgiu_json_result(uintptr_t ret, uint32_t *len) {
+	const uint8_t *p = (const uint8_t *)ret;
+	*len = (uint32_t)p[0] | (uint32_t)p[1] << 8 | (uint32_t)p[2] << 16 | (uint32_t)p[3] << 24;
+	return (const char *)(p + 4);
+}
+
+/* 解码string返回值 */
+static inline FuzzGIUString fuzzgiu_string_result(uintptr_t ret) {
+	FuzzGIUString s;
+	memcpy(&s, (const void *)ret, sizeof(s));
+	return s;
+}
+
+/* 解码stringList返回值：返回字符串个数，*cursor指向第一个元素 */
+static inline int32_t fuzzgiu_string_list_result(uintptr_t ret, const uint8_t **cursor) {
+	int32_t n;
+	memcpy(&n, (const void *)ret, 4);
+	*cursor = (const uint8_t *)ret + 4;
+	return n;
+}
+
+/* 读取stringList中的下一个元素，并移动*cursor */
+static inline FuzzGIUString fuzzgiu_string_list_next(const uint8_t **cursor) {
+	FuzzGIUString s;
+	int32_t n;
+	memcpy(&n, *cursor, 4);
+	s.p = (const char *)(*cursor + 4);
+	s.n = n;
+	*cursor += 4 + n;
+	return s;
+}
+
+#endif /* FUZZGIU_PLUGIN_H */
+`)
+	return sb.String()
+}
+
+// 将驼峰命名转换为宏名，如 payloadProc -> PAYLOAD_PROC
+func macroName(name string) string {
+	sb := strings.Builder{}
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' && i > 0 {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(r)
+	}
+	return strings.ToUpper(sb.String())
+}
+
+// 检查调用约定中的插件类型是否完整，供加载后的校验使用
+func (spec *abiSpec) validate() error {
+	for _, p := range spec.Plugins {
+		if p.Type == "" || p.Function == "" || p.Constructor == "" || p.HostMethod == "" {
+			return fmt.Errorf("plugin type %q is incomplete", p.Type)
+		}
+		for _, in := range p.Inputs {
+			if _, ok := spec.Encodings[in.Encoding]; !ok {
+				return fmt.Errorf("plugin type %s: unknown encoding %q", p.Type, in.Encoding)
+			}
+		}
+		if _, ok := spec.Encodings[p.Result.Encoding]; !ok {
+			return fmt.Errorf("plugin type %s: unknown result encoding %q", p.Type, p.Result.Encoding)
+		}
+	}
+	if len(spec.Plugins) == 0 {
+		return errors.New("no plugin types defined")
+	}
+	return nil
+}
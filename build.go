@@ -0,0 +1,541 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runBuild 实现 builder build -t type [options] pluginPath，与 builder -t type -build pluginPath 相同，
+// 使用-watch时在插件文件变化后自动重新构建。-json时标准输出只有事件（见buildEvent），最后一行为summary。
+// 退出码见exitUsage等常量
+func runBuild(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	opt := &buildOptions{}
+	fs.StringVar(&opt.TemplateType, "t", "", "template type, can be "+
+		"payloadProc,reactor,payloadGen,reqSender or preprocess. "+
+		"defaults to \"type\" in "+buildConfigName+" in the plugin directory")
+	applyConfig := addBuildFlags(fs, opt)
+	watch := fs.Bool("watch", false, "rebuild whenever files of the plugin module change")
+	runTests := fs.Bool("test", false, "run builder test fixtures after each successful build")
+	fixturesDir := fs.String("fixtures", "", "fixtures directory for -test, "+
+		"defaults to testdata in the plugin directory")
+	manifest := fs.String("manifest", "", "build all plugins listed in a JSON manifest such as plugins.json")
+	workers := fs.Int("j", 0, "number of plugins built concurrently with -manifest, "+
+		"defaults to the manifest's workers or the number of CPUs")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often -watch polls for changes")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder build -t type [options] pluginPath\n"+
+			"       builder build -manifest plugins.json [-j workers]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	start := time.Now()
+	var out io.Writer = os.Stdout
+	if opt.JSON { // 人类可读的输出不写入标准输出，改为事件
+		out = io.Discard
+		opt.Events = newEventWriter(os.Stdout)
+	}
+	built := 0
+	done := func(err error, failed int) { // 构建的结果已经输出，只输出summary并退出
+		opt.Events.summary(err, built, failed, time.Since(start))
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+	}
+	exit := func(err error, failed int) {
+		if err != nil && !opt.JSON {
+			fmt.Println(err)
+		}
+		done(err, failed)
+	}
+	toolchains := splitToolchains(opt.GoPath)
+	if len(toolchains) > 1 && (*watch || *manifest != "") {
+		exit(classify(exitUsage, fmt.Errorf("-watch and -manifest support a single toolchain in -gopath")), 0)
+	}
+	if *watch && opt.JSON {
+		exit(classify(exitUsage, fmt.Errorf("-json cannot be used with -watch")), 0)
+	}
+	if *manifest != "" { // 清单中各插件的构建参数以命令行参数为基础
+		if err := applyConfig(args, ""); err != nil {
+			exit(classify(exitUsage, err), 0)
+		}
+		var failed int
+		var err error
+		if built, failed, err = buildManifest(*manifest, *workers, opt, out); failed > 0 {
+			done(err, failed)
+		}
+		exit(classify(exitUsage, err), failed) // 清单无法读取
+		return
+	}
+	if fs.NArg() != 1 {
+		if opt.JSON {
+			exit(classify(exitUsage, fmt.Errorf("usage: builder build -t type [options] pluginPath")), 0)
+		}
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	opt.PluginPath = fs.Arg(0)
+	if err := applyConfig(args, opt.PluginPath); err != nil {
+		exit(classify(exitUsage, err), 0)
+	}
+	if opt.TemplateType == "" { // 命令行与构建配置中都没有指定插件类型
+		exit(classify(exitUsage, fmt.Errorf("template type is required, use -t or set \"type\" in %s", buildConfigName)), 0)
+	}
+	var testOpt *testOptions
+	if *runTests {
+		testOpt = &testOptions{TemplateType: opt.TemplateType, PluginPath: opt.PluginPath,
+			FixturesDir: *fixturesDir, GoPath: opt.GoPath, Env: opt.Env, Tags: opt.Tags, Mod: opt.Mod}
+	}
+	if len(toolchains) > 1 { // 兼容性检查：依次用每个工具链构建与测试
+		err := buildMatrix(opt, testOpt, toolchains, out)
+		if err == nil {
+			built = len(toolchains)
+		}
+		done(err, 0)
+		return
+	}
+	if !*watch {
+		err := buildCycle(opt, testOpt, out)
+		failed := 1
+		if err == nil {
+			built, failed = 1, 0
+		}
+		done(err, failed)
+		return
+	}
+	if err := watchPlugin(opt, testOpt, *interval, out); err != nil {
+		exit(err, 0)
+	}
+}
+
+// buildOptions 构建插件的参数
+type buildOptions struct {
+	TemplateType     string
+	PluginPath       string // 插件文件或目录
+	Output           string // 输出文件，相对路径相对于插件所在目录
+	GoPath           string
+	KeepIntermediate bool
+	Serial           bool
+	Concurrency      int      // 小于0时使用源文件中的指令
+	Env              []string // 追加到go build环境变量中，如GOOS=windows
+	NoCache          bool     // 不使用构建缓存
+	Tags             string   // go build -tags
+	Trimpath         bool     // go build -trimpath
+	Strip            bool     // 去除符号表与调试信息，即-ldflags="-s -w"
+	Ldflags          string   // 额外的-ldflags，如 -X main.version=1.0
+	Gcflags          string   // go build -gcflags
+	Race             bool     // go build -race
+	Repro            bool     // 可复现构建，见reproInputs
+	Mod              string   // go build -mod，如vendor，为空时由go命令决定
+	FuzzTypesDrift   string   // 插件的fuzzTypes与构建器中的SDK不兼容时：error（默认）构建失败，warn只警告，off不检查
+	Target           string   // 清单中的目标平台goos/goarch，只用于事件输出
+	JSON             bool     // -json，以每行一个JSON对象的事件输出构建过程
+	Events           *eventWriter
+}
+
+// buildConfig 构建配置文件（插件目录下的fuzzgiu.json，或由-config指定）中的插件类型与go build参数，
+// 清单中的插件也可以使用type以外的字段：
+//
+//	{"type": "reactor", "tags": "netgo", "trimpath": true, "strip": false, "ldflags": "-X main.version=1.0",
+//	 "gcflags": "all=-N -l", "race": false, "repro": false, "mod": "vendor", "fuzztypes_drift": "warn",
+//	 "env": {"CGO_CFLAGS": "-O2"}}
+//
+// 省略的字段保持默认值或命令行中指定的值，命令行中显式指定的参数优先于配置文件
+type buildConfig struct {
+	Type     *string           `json:"type"` // 插件类型，命令行中没有-t时使用
+	Tags     *string           `json:"tags"`
+	Trimpath *bool             `json:"trimpath"`
+	Strip    *bool             `json:"strip"`
+	Ldflags  *string           `json:"ldflags"`
+	Gcflags  *string           `json:"gcflags"`
+	Race     *bool             `json:"race"`
+	Repro    *bool             `json:"repro"`
+	Mod      *string           `json:"mod"`
+	Drift    *string           `json:"fuzztypes_drift"`
+	Env      map[string]string `json:"env"`
+}
+
+// 默认的构建配置文件名，位于插件所在目录
+const buildConfigName = "fuzzgiu.json"
+
+// 插件目录下构建配置中的插件类型，没有配置文件或其中没有type时返回空串。用于builder test与validate省略-t
+func configTemplateType(pluginPath string) string {
+	if conf := pluginBuildConfig(pluginPath); conf.Type != nil {
+		return *conf.Type
+	}
+	return ""
+}
+
+// 插件目录下的构建配置，不存在或无法读取时为空配置
+func pluginBuildConfig(pluginPath string) *buildConfig {
+	dir := pluginPath
+	if isFile, err := IsFile(pluginPath); err == nil && isFile {
+		dir = filepath.Dir(pluginPath)
+	}
+	conf := new(buildConfig)
+	if err := readJsonFile(filepath.Join(dir, buildConfigName), conf); err != nil {
+		return new(buildConfig)
+	}
+	return conf
+}
+
+// 将配置中出现的字段写入opt
+func (conf *buildConfig) apply(opt *buildOptions) {
+	if conf.Type != nil {
+		opt.TemplateType = *conf.Type
+	}
+	if conf.Tags != nil {
+		opt.Tags = *conf.Tags
+	}
+	if conf.Trimpath != nil {
+		opt.Trimpath = *conf.Trimpath
+	}
+	if conf.Strip != nil {
+		opt.Strip = *conf.Strip
+	}
+	if conf.Ldflags != nil {
+		opt.Ldflags = *conf.Ldflags
+	}
+	if conf.Gcflags != nil {
+		opt.Gcflags = *conf.Gcflags
+	}
+	if conf.Race != nil {
+		opt.Race = *conf.Race
+	}
+	if conf.Repro != nil {
+		opt.Repro = *conf.Repro
+	}
+	if conf.Mod != nil {
+		opt.Mod = *conf.Mod
+	}
+	if conf.Drift != nil {
+		opt.FuzzTypesDrift = *conf.Drift
+	}
+	keys := make([]string, 0, len(conf.Env))
+	for k := range conf.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // 固定顺序，使缓存键稳定
+	for _, k := range keys {
+		opt.Env = append(opt.Env, k+"="+conf.Env[k])
+	}
+}
+
+// 可重复指定的 -env KEY=VALUE 参数
+type envFlag struct {
+	env *[]string
+}
+
+func (f envFlag) String() string {
+	if f.env == nil {
+		return ""
+	}
+	return strings.Join(*f.env, " ")
+}
+
+func (f envFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+	*f.env = append(*f.env, value)
+	return nil
+}
+
+// addBuildFlags 向fs注册构建参数。返回的函数在解析命令行之后调用：读取配置文件（configPath为空时使用
+// 插件目录下的fuzzgiu.json，不存在则跳过），再次解析args，使命令行中显式指定的参数优先于配置文件
+func addBuildFlags(fs *flag.FlagSet, opt *buildOptions) func(args []string, pluginPath string) error {
+	fs.StringVar(&opt.Output, "o", "", "output file name")
+	fs.StringVar(&opt.GoPath, "gopath", "go", "go binary path be used to build the plugin. "+
+		"builder build accepts a comma-separated list to build and test with each toolchain")
+	fs.BoolVar(&opt.KeepIntermediate, "keep-intermediate", false, "keep intermediate files")
+	fs.BoolVar(&opt.Serial, "serial", false, "serialise calls into the plugin function, same as -concurrency 1")
+	fs.IntVar(&opt.Concurrency, "concurrency", -1, "max concurrent calls into the plugin function, "+
+		"0 for unlimited. overrides //fuzzgiu:serial and //fuzzgiu:concurrency directives in plugin source")
+	fs.BoolVar(&opt.NoCache, "no-cache", false, "always run go build, bypassing the build cache")
+	fs.StringVar(&opt.Tags, "tags", "", "comma-separated build tags passed to go build")
+	fs.BoolVar(&opt.Trimpath, "trimpath", true, "remove file system paths from the plugin (go build -trimpath)")
+	fs.BoolVar(&opt.Strip, "strip", true, "strip symbol table and debug information (-ldflags=\"-s -w\")")
+	fs.StringVar(&opt.Ldflags, "ldflags", "", "extra linker flags, e.g. \"-X main.version=1.0\"")
+	fs.StringVar(&opt.Gcflags, "gcflags", "", "flags passed to the compiler (go build -gcflags)")
+	fs.BoolVar(&opt.Race, "race", false, "enable the race detector (go build -race)")
+	fs.StringVar(&opt.Mod, "mod", "", "module download mode passed to go build: readonly, vendor or mod. "+
+		"use vendor to build offline from the module's vendor directory")
+	fs.BoolVar(&opt.JSON, "json", false, "print newline-delimited JSON events (stages, diagnostics, artifacts, "+
+		"summary) instead of the build log")
+	fs.BoolVar(&opt.Repro, "repro", false, "reproducible build: pin -trimpath, -buildvcs=false and the build ID, "+
+		"build in a fixed workspace and record input hashes for builder verify-repro")
+	fs.StringVar(&opt.FuzzTypesDrift, "fuzztypes-drift", "error", "what to do when the plugin's fuzzTypes differs "+
+		"from the builder's in ways FuzzGIU would not see (missing fields, renamed json tags, changed types): "+
+		"error, warn or off")
+	cliEnv := make([]string, 0)
+	fs.Var(envFlag{&cliEnv}, "env", "KEY=VALUE environment variable for go build, may be repeated")
+	configFile := fs.String("config", "", "build config file, defaults to "+buildConfigName+
+		" in the plugin directory if it exists")
+	return func(args []string, pluginPath string) error {
+		path := *configFile
+		if path == "" && pluginPath != "" {
+			dir := pluginPath
+			if isFile, err := IsFile(pluginPath); err == nil && isFile {
+				dir = filepath.Dir(pluginPath)
+			}
+			if _, err := os.Stat(filepath.Join(dir, buildConfigName)); err == nil {
+				path = filepath.Join(dir, buildConfigName)
+			}
+		}
+		if path != "" {
+			conf := new(buildConfig)
+			if err := readJsonFile(path, conf); err != nil {
+				return err
+			}
+			conf.apply(opt)
+		}
+		cliEnv = cliEnv[:0]
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		opt.Env = append(opt.Env, cliEnv...) // 命令行中的环境变量在后，优先于配置文件
+		switch opt.FuzzTypesDrift {
+		case "error", "warn", "off":
+		default:
+			return fmt.Errorf("-fuzztypes-drift must be error, warn or off, got %q", opt.FuzzTypesDrift)
+		}
+		return nil
+	}
+}
+
+// go build的参数，不包括-o与输出文件
+func (opt *buildOptions) buildArgs() []string {
+	args := []string{"build", "-buildmode=c-shared"}
+	if opt.Trimpath || opt.Repro {
+		args = append(args, "-trimpath")
+	}
+	if opt.Repro {
+		args = append(args, "-buildvcs=false")
+	}
+	if opt.Race {
+		args = append(args, "-race")
+	}
+	args = append(args, opt.modFlags()...)
+	if opt.Tags != "" {
+		args = append(args, "-tags", opt.Tags)
+	}
+	if opt.Gcflags != "" {
+		args = append(args, "-gcflags", opt.Gcflags)
+	}
+	ldflags := opt.Ldflags
+	if opt.Strip {
+		ldflags = strings.TrimSpace("-s -w " + ldflags)
+	}
+	if opt.Repro { // 清空Go的build ID，外部链接器的build ID由此派生
+		ldflags = strings.TrimSpace(ldflags + " -buildid=")
+	}
+	if ldflags != "" {
+		args = append(args, "-ldflags", ldflags)
+	}
+	return args
+}
+
+// 传给go build与go list的-mod参数
+func (opt *buildOptions) modFlags() []string {
+	if opt.Mod == "" {
+		return nil
+	}
+	return []string{"-mod=" + opt.Mod}
+}
+
+// go build的环境变量。可复现构建清空GOFLAGS，避免环境中的GOFLAGS（如-mod=mod）改变构建
+func (opt *buildOptions) buildEnv() []string {
+	env := append(os.Environ(), opt.Env...)
+	if opt.Repro {
+		env = append(env, "GOFLAGS=")
+	}
+	return env
+}
+
+// 输出文件名，未指定时为 FuzzGIU+插件函数名+.dll
+func (opt *buildOptions) outputName() string {
+	if opt.Output != "" {
+		return opt.Output
+	}
+	return "FuzzGIU" + getPluginFunName(opt.TemplateType) + ".dll"
+}
+
+// 插件路径是否为目录。目录以包模式构建，编译目录下的整个包；文件只编译该文件
+func (opt *buildOptions) isPackage() bool {
+	isFile, err := IsFile(opt.PluginPath)
+	return err == nil && !isFile
+}
+
+// 插件源文件路径，路径是目录时采用目录下的plugin.go文件
+func (opt *buildOptions) pluginFile() (string, error) {
+	isFile, err := IsFile(opt.PluginPath)
+	if err != nil {
+		return "", err
+	}
+	if !isFile {
+		return filepath.Join(opt.PluginPath, "plugin.go"), nil
+	}
+	return opt.PluginPath, nil
+}
+
+// buildResult 构建结果
+type buildResult struct {
+	Source   *pluginSource
+	Output   string // 输出文件的绝对路径
+	CacheKey string // 未使用缓存时为空
+	Cached   bool   // 是否直接使用了缓存中的构建产物
+}
+
+// buildPlugin 解析并包装插件，以c-shared方式编译，go build的输出写入out。
+// 先编译到输出目录下的临时文件，成功后再重命名为输出文件，使正在使用输出文件的进程不会读到写了一半的文件。
+// 启用缓存时，构建产物以缓存键保存在缓存目录中，缓存键相同时直接复制缓存中的产物。
+// 返回的错误按退出码分类（见builderError），opt.Events不为nil时输出各阶段的事件
+func buildPlugin(opt *buildOptions, out io.Writer) (*buildResult, error) {
+	end := opt.Events.stage(opt, "parse")
+	pluginPath, err := opt.pluginFile()
+	if err != nil {
+		return nil, end(classify(exitUsage, err), "")
+	}
+	// 解析插件文件，检查函数签名
+	src, err := parsePlugin(pluginPath, opt.TemplateType)
+	if err != nil {
+		return nil, end(&builderError{Code: exitSignature, Err: err, Diagnostics: parseDiagnostics(pluginPath, err)}, "")
+	}
+	end(nil, "ok")
+	if opt.Serial { // 命令行参数优先于源文件中的指令
+		src.Concurrency = 1
+	} else if opt.Concurrency >= 0 {
+		src.Concurrency = opt.Concurrency
+	}
+	src.Package = opt.isPackage()
+	end = opt.Events.stage(opt, "wrap")
+	dir, err := filepath.Abs(filepath.Dir(pluginPath))
+	if err != nil {
+		return nil, end(classify(exitUsage, err), "")
+	}
+	mod, err := findModule(opt, dir)
+	if err != nil {
+		return nil, end(classify(exitEnvironment, err), "")
+	}
+	// 写入元数据的SDK版本，无法解析fuzzTypes包时由编译阶段报告
+	src.FuzzTypes, _ = fuzzTypesVersion(opt, dir, src)
+	if opt.FuzzTypesDrift != "off" {
+		// 无法加载fuzzTypes包时同样由编译阶段报告
+		if diags, err := checkFuzzTypesDrift(opt, dir, src); err == nil {
+			if err = fuzzTypesDriftError(opt, diags, out); err != nil {
+				return nil, end(err, "")
+			}
+		}
+	}
+	buildDir := dir // 运行go build的目录，可复现构建时为固定路径下的工作区
+	if opt.Repro {
+		if src.Repro, err = collectReproInputs(opt, src, dir, mod); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+		if buildDir, err = prepareReproWorkspace(dir, src.Repro); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+		if !opt.KeepIntermediate {
+			defer os.RemoveAll(reproWorkspace(src.Repro))
+		}
+	}
+	resolveImportNames(opt.GoPath, dir, opt.buildEnv(), opt.modFlags(), src)
+	tmpl, err := wrapPlugin(src)
+	if err != nil {
+		return nil, end(classify(exitEnvironment, err), "") // 模板缺失或损坏
+	}
+	wrappedPath := filepath.Join(buildDir, "wrappedPlugin.go") // 编译过程中生成的临时文件
+	if err = os.WriteFile(wrappedPath, tmpl, 0644); err != nil {
+		return nil, end(classify(exitEnvironment, err), "")
+	}
+	if !opt.KeepIntermediate {
+		defer os.Remove(wrappedPath) // 临时文件编译结束后删除
+	}
+	end(nil, "ok")
+	end = opt.Events.stage(opt, "compile")
+	result := &buildResult{Source: src, Output: opt.outputName()}
+	if !filepath.IsAbs(result.Output) {
+		result.Output = filepath.Join(dir, result.Output)
+	}
+	if err = os.MkdirAll(filepath.Dir(result.Output), 0755); err != nil {
+		return nil, end(classify(exitEnvironment, err), "")
+	}
+	ext := filepath.Ext(result.Output)
+	tmpOutput := strings.TrimSuffix(result.Output, ext) + ".building" + ext
+	headerFile := strings.TrimSuffix(result.Output, ext) + ".h"
+	tmpHeaderFile := strings.TrimSuffix(tmpOutput, ext) + ".h"
+	defer os.Remove(tmpOutput)
+	defer os.Remove(tmpHeaderFile) // 删除编译时生成的.h文件
+	target := "./wrappedPlugin.go" // 文件模式只编译包装文件（其中内联了插件源码）
+	if src.Package {
+		target = "."
+	}
+	var cache *buildCache
+	if !opt.NoCache {
+		if cache, err = openBuildCache(); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+		if result.CacheKey, err = buildCacheKey(opt, buildDir, target); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+		if result.Cached, err = cache.get(result.CacheKey, tmpOutput, tmpHeaderFile); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+	}
+	if !result.Cached {
+		build := exec.Command(opt.GoPath, append(opt.buildArgs(), "-o", tmpOutput, target)...)
+		build.Dir = buildDir
+		build.Env = opt.buildEnv()
+		output, err := build.CombinedOutput()
+		if err != nil {
+			var be *builderError
+			if err = goCommandError("go build", err, output); !errors.As(err, &be) {
+				be = &builderError{Code: exitCompile, Err: err, Diagnostics: goBuildDiagnostics(output, buildDir)}
+				mapDiagnostics(be.Diagnostics, src, tmpl, buildDir, dir)
+			}
+			return nil, end(be, "")
+		}
+		out.Write(output)
+		warnings := goBuildDiagnostics(output, buildDir) // 构建成功时的输出只有C编译器的警告
+		mapDiagnostics(warnings, src, tmpl, buildDir, dir)
+		for _, d := range warnings {
+			d.Severity = "warning"
+			opt.Events.emit(&buildEvent{Event: "diagnostic", Stage: "compile", Plugin: opt.PluginPath,
+				Target: opt.Target, Diagnostic: d})
+		}
+		if cache != nil {
+			if err = cache.put(result.CacheKey, tmpOutput, tmpHeaderFile, newCacheEntry(opt, src)); err != nil {
+				return nil, end(classify(exitEnvironment, err), "")
+			}
+		}
+	}
+	if opt.KeepIntermediate {
+		if err = os.Rename(tmpHeaderFile, headerFile); err != nil {
+			return nil, end(classify(exitEnvironment, err), "")
+		}
+	}
+	if err = os.Rename(tmpOutput, result.Output); err != nil {
+		return nil, end(classify(exitEnvironment, err), "")
+	}
+	status := "ok"
+	if result.Cached {
+		status = "cached"
+	}
+	end(nil, status)
+	if opt.Events != nil {
+		artifact := &artifactInfo{Path: result.Output, Cached: result.Cached, CacheKey: result.CacheKey}
+		if artifact.SHA256, artifact.Size, err = fileDigest(result.Output); err != nil {
+			return nil, err
+		}
+		opt.Events.emit(&buildEvent{Event: "artifact", Plugin: opt.PluginPath, Target: opt.Target, Artifact: artifact})
+	}
+	return result, nil
+}
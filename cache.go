@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 缓存键格式的版本，缓存键的计算方式改变时修改
+const buildCacheVersion = "fuzzgiu-build-cache 1"
+
+// buildCache 以内容寻址的构建缓存，默认位于用户缓存目录下的fuzzgiu-builder，可以通过环境变量FUZZGIU_CACHE指定。
+// 每个条目由 <key>.lib（动态库）、<key>.h（cgo生成的头文件）与 <key>.json（条目信息）组成，
+// 保存在以缓存键前两位命名的子目录中
+type buildCache struct {
+	Dir string
+}
+
+// cacheEntry 缓存条目的信息，仅用于cache ls显示
+type cacheEntry struct {
+	Key       string    `json:"key"`
+	Type      string    `json:"type"`
+	Plugin    string    `json:"plugin"` // 插件文件
+	Output    string    `json:"output"` // 首次构建时的输出文件名
+	Env       []string  `json:"env,omitempty"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"-"` // 取自条目信息文件的修改时间，每次命中时更新
+}
+
+func newCacheEntry(opt *buildOptions, src *pluginSource) *cacheEntry {
+	plugin, _ := filepath.Abs(src.Path)
+	return &cacheEntry{Type: opt.TemplateType, Plugin: plugin, Output: opt.outputName(), Env: opt.Env}
+}
+
+func openBuildCache() (*buildCache, error) {
+	dir := os.Getenv("FUZZGIU_CACHE")
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate build cache, set FUZZGIU_CACHE: %v", err)
+		}
+		dir = filepath.Join(userCache, "fuzzgiu-builder")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &buildCache{Dir: dir}, nil
+}
+
+// 缓存条目中文件的路径，ext为.lib、.h或.json
+func (c *buildCache) path(key, ext string) string {
+	return filepath.Join(c.Dir, key[:2], key+ext)
+}
+
+// buildCacheKey 计算在dir中构建target的缓存键，包括：构建参数与环境变量、go env给出的Go版本与目标平台、
+// target依赖的所有非标准库包的源文件（包含包装文件，即模板内容与components/fuzzTypes等），以及go.mod、go.sum与go.work
+func buildCacheKey(opt *buildOptions, dir, target string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\nargs %q %s\nenv %q\n", buildCacheVersion, opt.buildArgs(), target, opt.Env)
+	values, err := goEnv(opt, dir, "GOVERSION", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64",
+		"CGO_ENABLED", "CC", "CGO_CFLAGS", "CGO_LDFLAGS", "GOFLAGS", "GOMOD", "GOWORK")
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "go env %s=%s\n", name, values[name])
+	}
+	moduleFiles := make([]string, 0, 4)
+	if gomod := values["GOMOD"]; gomod != "" && gomod != os.DevNull {
+		moduleFiles = append(moduleFiles, gomod, strings.TrimSuffix(gomod, ".mod")+".sum")
+	}
+	if gowork := values["GOWORK"]; gowork != "" && gowork != "off" {
+		moduleFiles = append(moduleFiles, gowork, gowork+".sum")
+	}
+	for _, name := range moduleFiles {
+		if err = hashFile(h, name); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	// 与packageSources一样包括汇编、C++、Objective-C、Fortran与.syso文件
+	format := "{{if not .Standard}}{{.Dir}}"
+	for _, field := range []string{"GoFiles", "CgoFiles", "CFiles", "CXXFiles", "MFiles", "HFiles", "FFiles",
+		"SFiles", "SysoFiles", "EmbedFiles"} {
+		format += "{{range ." + field + "}}|{{.}}{{end}}"
+	}
+	args := append([]string{"list", "-deps"}, opt.modFlags()...)
+	list := exec.Command(opt.GoPath, append(args, "-f", format+"{{end}}", target)...)
+	list.Dir = dir
+	list.Env = opt.buildEnv()
+	stderr := bytes.Buffer{}
+	list.Stderr = &stderr
+	deps, err := list.Output()
+	if err != nil {
+		return "", goCommandError("go list", err, stderr.Bytes())
+	}
+	lines := bufio.NewScanner(bytes.NewReader(deps))
+	for lines.Scan() {
+		files := strings.Split(lines.Text(), "|")
+		for _, name := range files[1:] {
+			if err = hashFile(h, filepath.Join(files[0], name)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 在dir中以构建时的环境变量运行go env -json，返回names对应的值
+func goEnv(opt *buildOptions, dir string, names ...string) (map[string]string, error) {
+	cmd := exec.Command(opt.GoPath, append([]string{"env", "-json"}, names...)...)
+	cmd.Dir = dir
+	cmd.Env = opt.buildEnv()
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, goCommandError("go env", err, stderr.Bytes())
+	}
+	values := make(map[string]string)
+	if err = json.Unmarshal(output, &values); err != nil {
+		return nil, fmt.Errorf("go env failed: %v", err)
+	}
+	return values, nil
+}
+
+// 将文件名与内容写入h
+func hashFile(h io.Writer, name string) error {
+	return hashFileAs(h, name, name)
+}
+
+// 将文件name的内容写入h，写入的文件名为label
+func hashFileAs(h io.Writer, label, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "file %s\n", label)
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// get 缓存命中时将动态库与头文件复制到lib与header，返回是否命中
+func (c *buildCache) get(key, lib, header string) (bool, error) {
+	if _, err := os.Stat(c.path(key, ".lib")); err != nil {
+		return false, nil
+	}
+	if err := copyFile(c.path(key, ".lib"), lib); err != nil {
+		return false, err
+	}
+	if err := copyFile(c.path(key, ".h"), header); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	os.Chtimes(c.path(key, ".json"), now, now) // 记录最后使用时间
+	return true, nil
+}
+
+// put 将构建产物保存到缓存，先写入临时文件再重命名，使并发的构建不会读到不完整的条目
+func (c *buildCache) put(key, lib, header string, entry *cacheEntry) error {
+	if err := os.MkdirAll(filepath.Join(c.Dir, key[:2]), 0755); err != nil {
+		return err
+	}
+	info, err := os.Stat(lib)
+	if err != nil {
+		return err
+	}
+	entry.Key, entry.Size, entry.CreatedAt = key, info.Size(), time.Now()
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf(".tmp%d", os.Getpid())
+	if err = os.WriteFile(c.path(key, ".json"+tmp), data, 0644); err != nil {
+		return err
+	}
+	if err = copyFile(header, c.path(key, ".h"+tmp)); err != nil {
+		return err
+	}
+	if err = copyFile(lib, c.path(key, ".lib"+tmp)); err != nil {
+		return err
+	}
+	// .lib最后重命名，get以.lib是否存在判断条目是否完整
+	for _, ext := range []string{".json", ".h", ".lib"} {
+		if err = os.Rename(c.path(key, ext+tmp), c.path(key, ext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 列出缓存中的所有条目，按最后使用时间从新到旧排序
+func (c *buildCache) list() ([]*cacheEntry, error) {
+	metas, err := filepath.Glob(filepath.Join(c.Dir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*cacheEntry, 0, len(metas))
+	for _, meta := range metas {
+		entry := new(cacheEntry)
+		if err = readJsonFile(meta, entry); err != nil {
+			continue
+		}
+		if info, err := os.Stat(meta); err == nil {
+			entry.LastUsed = info.ModTime()
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// 删除缓存条目
+func (c *buildCache) remove(key string) error {
+	for _, ext := range []string{".lib", ".h", ".json"} {
+		if err := os.Remove(c.path(key, ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCache 实现 builder cache ls|prune|dir
+func runCache(args []string) {
+	usage := "usage: builder cache ls [-json]\n" +
+		"       builder cache prune [-older-than 720h | -all]\n" +
+		"       builder cache dir"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+	cache, err := openBuildCache()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "dir":
+		fmt.Println(cache.Dir)
+	case "ls":
+		jsonOutput := fs.Bool("json", false, "print entries as JSON")
+		fs.Parse(args[1:])
+		entries, err := cache.list()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if *jsonOutput {
+			out, _ := json.MarshalIndent(entries, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		total := int64(0)
+		for _, entry := range entries {
+			total += entry.Size
+			fmt.Printf("%s  %-11s %7.1fMB  used %s  %s\n", entry.Key[:12], entry.Type,
+				float64(entry.Size)/(1<<20), entry.LastUsed.Format("2006-01-02 15:04"), entry.Plugin)
+		}
+		fmt.Printf("%d entries, %.1fMB in %s\n", len(entries), float64(total)/(1<<20), cache.Dir)
+	case "prune":
+		olderThan := fs.Duration("older-than", 30*24*time.Hour, "remove entries not used for this long")
+		all := fs.Bool("all", false, "remove all entries")
+		fs.Parse(args[1:])
+		entries, err := cache.list()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		removed, freed := 0, int64(0)
+		for _, entry := range entries {
+			if !*all && time.Since(entry.LastUsed) < *olderThan {
+				continue
+			}
+			if err = cache.remove(entry.Key); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			removed++
+			freed += entry.Size
+		}
+		fmt.Printf("removed %d entries, freed %.1fMB\n", removed, float64(freed)/(1<<20))
+	default:
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+}
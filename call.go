@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+	"FuzzGIUPluginBuilder/host"
+)
+
+// 插件调用的输入，格式与builder test的用例相同
+type callInput struct {
+	Args     []json.RawMessage   `json:"args"`
+	CtorArgs []json.RawMessage   `json:"ctor_args"`
+	Payload  string              `json:"payload"`
+	Req      *fuzzTypes.Req      `json:"req"`
+	Resp     *fuzzTypes.Resp     `json:"resp"`
+	Fuzz     *fuzzTypes.Fuzz     `json:"fuzz"`
+	SendMeta *fuzzTypes.SendMeta `json:"send_meta"`
+}
+
+// runCall 实现 builder call [options] lib：用参考宿主（host包）加载构建出的插件动态库，
+// 按FuzzGIU的调用方式传参并解码返回值。输入可以是builder test的用例文件，也可以由各参数单独指定
+func runCall(args []string) {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	templateType := fs.String("t", "", "template type, read from plugin metadata if omitted")
+	fixture := fs.String("fixture", "", "fixture file in builder test format, "+
+		"the plugin output is compared with its expect field")
+	argsJson := fs.String("args", "", "custom arguments as a JSON array")
+	ctorArgsJson := fs.String("ctor-args", "", "constructor arguments of instance plugins as a JSON array")
+	payload := fs.String("payload", "", "payload passed to payloadProc plugins")
+	reqFile := fs.String("req", "", "JSON file of fuzzTypes.Req passed to reactors")
+	respFile := fs.String("resp", "", "JSON file of fuzzTypes.Resp passed to reactors")
+	fuzzFile := fs.String("fuzz", "", "JSON file of fuzzTypes.Fuzz passed to preprocessors")
+	sendMetaFile := fs.String("send-meta", "", "JSON file of fuzzTypes.SendMeta passed to reqSenders")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder call [options] pluginLib")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	input := new(callInput)
+	if *fixture != "" {
+		if err := readJsonFile(*fixture, input); err != nil {
+			fmt.Println(err)
+			os.Exit(exitUsage)
+		}
+	}
+	// 单独指定的参数覆盖用例文件中的值
+	overrides := []struct {
+		file string
+		v    interface{}
+	}{{*reqFile, &input.Req}, {*respFile, &input.Resp}, {*fuzzFile, &input.Fuzz}, {*sendMetaFile, &input.SendMeta}}
+	for _, o := range overrides {
+		if o.file == "" {
+			continue
+		}
+		if err := readJsonFile(o.file, o.v); err != nil {
+			fmt.Println(err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *argsJson != "" {
+		if err := json.Unmarshal([]byte(*argsJson), &input.Args); err != nil {
+			fmt.Printf("bad -args: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *ctorArgsJson != "" {
+		if err := json.Unmarshal([]byte(*ctorArgsJson), &input.CtorArgs); err != nil {
+			fmt.Printf("bad -ctor-args: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *payload != "" {
+		input.Payload = *payload
+	}
+	output, err := callPlugin(fs.Arg(0), *templateType, input)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitFailure)
+	}
+	pretty, _ := json.MarshalIndent(output, "", "  ")
+	fmt.Println(string(pretty))
+	if *fixture != "" {
+		ok, detail := checkFixture(*fixture, &fixtureResult{Name: *fixture, Output: output})
+		if !ok {
+			fmt.Printf("FAIL %s\n%s", *fixture, detail)
+			os.Exit(exitFailure)
+		}
+		fmt.Printf("PASS %s\n", *fixture)
+	}
+}
+
+// callPlugin 加载插件并以input调用一次，返回JSON编码的插件输出
+func callPlugin(libPath, templateType string, input *callInput) (json.RawMessage, error) {
+	plugin, err := host.Open(libPath)
+	if err != nil {
+		return nil, err
+	}
+	var params, ctorParams []host.Param
+	if plugin.Meta != nil {
+		if templateType == "" {
+			templateType = plugin.Meta.Type
+		}
+		params, ctorParams = plugin.Meta.Params, plugin.Meta.CtorParams
+	}
+	if templateType == "" {
+		return nil, fmt.Errorf("%s has no plugin metadata, template type is required", libPath)
+	}
+	args, err := host.ConvertArgs(params, input.Args)
+	if err != nil {
+		return nil, err
+	}
+	var caller *host.Caller
+	if plugin.Meta != nil && plugin.Meta.Instance {
+		ctorArgs, err := host.ConvertArgs(ctorParams, input.CtorArgs)
+		if err != nil {
+			return nil, fmt.Errorf("constructor: %v", err)
+		}
+		caller, err = plugin.NewInstance(ctorArgs...)
+		if err != nil {
+			return nil, err
+		}
+		defer caller.Free()
+	} else if caller, err = plugin.Func(); err != nil {
+		return nil, err
+	}
+	var output interface{}
+	switch templateType {
+	case "payloadProc":
+		output, err = caller.PayloadProc(input.Payload, args...)
+	case "reactor":
+		if input.Req == nil {
+			input.Req = new(fuzzTypes.Req)
+		}
+		if input.Resp == nil {
+			input.Resp = new(fuzzTypes.Resp)
+		}
+		output, err = caller.React(input.Req, input.Resp, args...)
+	case "preprocess":
+		if input.Fuzz == nil {
+			input.Fuzz = new(fuzzTypes.Fuzz)
+		}
+		output, err = caller.Preprocess(input.Fuzz, args...)
+	case "payloadGen":
+		output, err = caller.PayloadGen(args...)
+	case "reqSender":
+		if input.SendMeta == nil {
+			input.SendMeta = new(fuzzTypes.SendMeta)
+		}
+		output, err = caller.ReqSend(input.SendMeta, args...)
+	default:
+		return nil, fmt.Errorf("unsupported template type: %s", templateType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
+
+func readJsonFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
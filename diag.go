@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 构建命令（builder build与 builder -build）的退出码，-json模式与普通模式相同
+const (
+	exitFailure     = 1 // 其他失败，如用例不通过
+	exitUsage       = 2 // 命令行参数错误
+	exitSignature   = 3 // 插件源码无法解析，插件函数签名不符合ABI，或插件的fuzzTypes与FuzzGIU不兼容
+	exitCompile     = 4 // go build编译失败
+	exitEnvironment = 5 // Go工具链、cgo、C编译器、模块或模板等环境问题
+)
+
+// builderError 带分类的错误，Code为对应的退出码
+type builderError struct {
+	Code        int
+	Err         error
+	Diagnostics []*diagnostic
+}
+
+func (e *builderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *builderError) Unwrap() error {
+	return e.Err
+}
+
+// 将err归为code类，err已经分类时保持原来的分类
+func classify(code int, err error) error {
+	var be *builderError
+	if err == nil || errors.As(err, &be) {
+		return err
+	}
+	return &builderError{Code: code, Err: err}
+}
+
+// 错误对应的退出码，未分类的错误为exitFailure
+func exitCode(err error) int {
+	var be *builderError
+	if errors.As(err, &be) {
+		return be.Code
+	}
+	return exitFailure
+}
+
+// diagnostic 定位到源文件的问题
+type diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"` // error或warning
+	Code     string `json:"code"`     // syntax、signature、fuzztypes、compile、cc、link、module或environment
+	Message  string `json:"message"`
+}
+
+// 解析插件失败时的诊断信息：语法错误逐条定位，其他错误（如签名不符）定位到插件文件。路径均为绝对路径
+func parseDiagnostics(pluginPath string, err error) []*diagnostic {
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		diags := make([]*diagnostic, 0, len(list))
+		for _, e := range list {
+			file, _ := filepath.Abs(e.Pos.Filename)
+			diags = append(diags, &diagnostic{File: file, Line: e.Pos.Line, Column: e.Pos.Column,
+				Severity: "error", Code: "syntax", Message: e.Msg})
+		}
+		return diags
+	}
+	file, _ := filepath.Abs(pluginPath)
+	return []*diagnostic{{File: file, Severity: "error", Code: "signature", Message: err.Error()}}
+}
+
+// go build与C编译器输出中的 file:line[:column]: message
+var compilerMessageRe = regexp.MustCompile(`^(.+?\.(?:go|c|h|s|cc|cpp)):(\d+)(?::(\d+))?: (.*)$`)
+
+// goBuildDiagnostics 从go build的输出中提取诊断信息，相对路径相对于dir。
+// 没有可定位的信息时（如链接失败），返回一条不带位置的诊断
+func goBuildDiagnostics(output []byte, dir string) []*diagnostic {
+	diags := make([]*diagnostic, 0)
+	other := make([]string, 0)
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		line := lines.Text()
+		m := compilerMessageRe.FindStringSubmatch(line)
+		if m == nil {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				other = append(other, strings.TrimSpace(line))
+			}
+			continue
+		}
+		d := &diagnostic{File: m[1], Severity: "error", Code: "compile", Message: m[4]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		if !filepath.IsAbs(d.File) { // 不在dir中的相对路径来自标准库（如runtime/cgo的C文件），保持原样
+			if isFile, _ := IsFile(filepath.Join(dir, d.File)); isFile {
+				d.File = filepath.Join(dir, d.File)
+			}
+		}
+		if filepath.Ext(d.File) != ".go" { // C编译器的输出带有 error: warning: note: 前缀
+			d.Code = "cc"
+			switch {
+			case strings.HasPrefix(d.Message, "note: "):
+				continue
+			case strings.HasPrefix(d.Message, "warning: "):
+				d.Severity, d.Message = "warning", strings.TrimPrefix(d.Message, "warning: ")
+			default:
+				d.Message = strings.TrimPrefix(strings.TrimPrefix(d.Message, "fatal error: "), "error: ")
+			}
+		}
+		diags = append(diags, d)
+	}
+	if len(diags) == 0 && len(other) > 0 {
+		code := "compile"
+		if bytes.Contains(output, []byte("ld returned")) || bytes.Contains(output, []byte("undefined reference")) {
+			code = "link"
+		}
+		diags = append(diags, &diagnostic{Severity: "error", Code: code, Message: strings.Join(other, "\n")})
+	}
+	return diags
+}
+
+// 将诊断信息中的位置映射回插件源码：可复现构建的工作区buildDir映射回插件目录dir；
+// 文件模式下包装文件中内联的插件源码映射回插件文件中的行
+func mapDiagnostics(diags []*diagnostic, src *pluginSource, wrapper []byte, buildDir, dir string) {
+	wrapperPath := filepath.Join(buildDir, "wrappedPlugin.go")
+	codeLine, pluginLine, codeLines := 0, 0, strings.Count(src.Code, "\n")+1
+	if !src.Package && src.Code != "" {
+		if i := bytes.Index(wrapper, []byte(src.Code)); i >= 0 {
+			codeLine = bytes.Count(wrapper[:i], []byte("\n")) + 1
+			if content, err := os.ReadFile(src.Path); err == nil && len(content) >= len(src.Code) {
+				pluginLine = bytes.Count(content[:len(content)-len(src.Code)], []byte("\n")) + 1
+			}
+		}
+	}
+	for _, d := range diags {
+		if d.File == wrapperPath && codeLine > 0 && pluginLine > 0 &&
+			d.Line >= codeLine && d.Line < codeLine+codeLines {
+			d.File, _ = filepath.Abs(src.Path)
+			d.Line = d.Line - codeLine + pluginLine
+			continue
+		}
+		if buildDir != dir && d.File != "" {
+			if rel, err := filepath.Rel(buildDir, d.File); err == nil && !strings.HasPrefix(rel, "..") {
+				d.File = filepath.Join(dir, rel)
+			}
+		}
+	}
+}
+
+// artifactInfo 构建产物
+type artifactInfo struct {
+	Path     string `json:"path"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Cached   bool   `json:"cached"`
+	CacheKey string `json:"cache_key,omitempty"`
+}
+
+// 文件的sha256与大小
+func fileDigest(name string) (string, int64, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), int64(len(data)), nil
+}
+
+// buildEvent -json模式输出的事件，每行一个JSON对象：
+//
+//	stage_start/stage_end  构建阶段parse、wrap、compile、test的开始与结束，结束时带status（ok、fail或cached）与耗时
+//	diagnostic             定位到源文件的问题
+//	artifact               生成的动态库及其sha256
+//	test                   builder build -test运行用例的通过数与失败数
+//	summary                整个命令的结果与退出码
+type buildEvent struct {
+	Time       time.Time     `json:"time"`
+	Event      string        `json:"event"`
+	Stage      string        `json:"stage,omitempty"`
+	Plugin     string        `json:"plugin,omitempty"` // 插件路径
+	Target     string        `json:"target,omitempty"` // goos/goarch，仅清单中指定了targets时
+	Status     string        `json:"status,omitempty"`
+	Elapsed    float64       `json:"elapsed,omitempty"` // 秒
+	Error      string        `json:"error,omitempty"`
+	Diagnostic *diagnostic   `json:"diagnostic,omitempty"`
+	Artifact   *artifactInfo `json:"artifact,omitempty"`
+	Passed     int           `json:"passed,omitempty"` // test阶段通过与失败的用例数
+	Failed     int           `json:"failed,omitempty"`
+	Built      int           `json:"built,omitempty"` // summary中成功的构建数
+	ExitCode   *int          `json:"exit_code,omitempty"`
+}
+
+// eventWriter 向out输出事件，可被多个构建协程共用。为nil时不输出
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventWriter(out io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(out)}
+}
+
+func (w *eventWriter) emit(ev *buildEvent) {
+	if w == nil {
+		return
+	}
+	ev.Time = time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(ev)
+}
+
+// stage 输出阶段开始事件，返回的函数输出错误中的诊断信息与阶段结束事件，并原样返回错误
+func (w *eventWriter) stage(opt *buildOptions, name string) func(err error, status string) error {
+	start := time.Now()
+	w.emit(&buildEvent{Event: "stage_start", Stage: name, Plugin: opt.PluginPath, Target: opt.Target})
+	return func(err error, status string) error {
+		ev := &buildEvent{Event: "stage_end", Stage: name, Plugin: opt.PluginPath, Target: opt.Target,
+			Status: status, Elapsed: time.Since(start).Seconds()}
+		if err != nil {
+			var be *builderError
+			if errors.As(err, &be) {
+				for _, d := range be.Diagnostics {
+					w.emit(&buildEvent{Event: "diagnostic", Stage: name, Plugin: opt.PluginPath,
+						Target: opt.Target, Diagnostic: d})
+				}
+			}
+			ev.Status, ev.Error = "fail", err.Error()
+		}
+		w.emit(ev)
+		return err
+	}
+}
+
+// 输出summary事件
+func (w *eventWriter) summary(err error, built, failed int, elapsed time.Duration) {
+	code, status := 0, "ok"
+	if err != nil {
+		code, status = exitCode(err), "fail"
+	}
+	ev := &buildEvent{Event: "summary", Status: status, Built: built, Failed: failed,
+		Elapsed: elapsed.Seconds(), ExitCode: &code}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	w.emit(ev)
+}
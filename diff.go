@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// lineDiff 逐行比较两段文本，返回类似diff的结果：" "开头为相同行，"-"开头为仅在a中的行，"+"开头为仅在b中的行
+func lineDiff(a, b string) string {
+	aLines := strings.Split(strings.TrimRight(a, "\n"), "\n")
+	bLines := strings.Split(strings.TrimRight(b, "\n"), "\n")
+	// lcs[i][j] 为 aLines[i:] 与 bLines[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	sb := strings.Builder{}
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			sb.WriteString("  " + aLines[i] + "\n")
+			i++
+			j++
+		case j == len(bLines) || (i < len(aLines) && lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + aLines[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + bLines[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
+
+// typesDiff 比较两个版本的fuzzTypes.go中声明的类型与常量，返回变化的列表：
+// "+ Req.Data string `json:\"data\"`" 为新增，"- ..." 为删除，"~ ... -> ..." 为类型、tag或值的修改。
+// 匿名结构体中的字段展开为 Fuzz.Send.Timeout 的形式
+func typesDiff(oldSrc, newSrc []byte) ([]string, error) {
+	oldDecls, err := typeDecls(oldSrc)
+	if err != nil {
+		return nil, err
+	}
+	newDecls, err := typeDecls(newSrc)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(oldDecls)+len(newDecls))
+	for name := range oldDecls {
+		names = append(names, name)
+	}
+	for name := range newDecls {
+		if _, ok := oldDecls[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := make([]string, 0)
+	for _, name := range names {
+		o, inOld := oldDecls[name]
+		n, inNew := newDecls[name]
+		switch {
+		case !inOld:
+			changes = append(changes, "+ "+name+" "+n)
+		case !inNew:
+			changes = append(changes, "- "+name+" "+o)
+		case o != n:
+			changes = append(changes, "~ "+name+" "+o+" -> "+n)
+		}
+	}
+	return changes, nil
+}
+
+// 源文件中的类型、字段与常量，值为类型（字段带tag）或常量的值
+func typeDecls(src []byte) (map[string]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "fuzzTypes.go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	decls := make(map[string]string)
+	nodeString := func(node ast.Node) string {
+		buf := bytes.Buffer{}
+		printer.Fprint(&buf, fset, node)
+		return buf.String()
+	}
+	var walk func(prefix string, st *ast.StructType)
+	walk = func(prefix string, st *ast.StructType) {
+		for _, field := range st.Fields.List {
+			names := make([]string, 0, len(field.Names))
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			if len(names) == 0 { // 嵌入的字段
+				names = append(names, nodeString(field.Type))
+			}
+			typ := nodeString(field.Type)
+			if inner, ok := field.Type.(*ast.StructType); ok {
+				typ = "struct"
+				for _, name := range names {
+					walk(prefix+name+".", inner)
+				}
+			}
+			if field.Tag != nil {
+				typ += " " + field.Tag.Value
+			}
+			for _, name := range names {
+				decls[prefix+name] = typ
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					decls[spec.Name.Name] = "struct"
+					walk(spec.Name.Name+".", st)
+				} else {
+					decls[spec.Name.Name] = nodeString(spec.Type)
+				}
+			case *ast.ValueSpec:
+				if gen.Tok != token.CONST {
+					continue
+				}
+				for i, name := range spec.Names {
+					value := ""
+					if i < len(spec.Values) {
+						value = "= " + nodeString(spec.Values[i])
+					}
+					decls[name.Name] = strings.TrimSpace("const " + value)
+				}
+			}
+		}
+	}
+	return decls, nil
+}
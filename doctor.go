@@ -0,0 +1,287 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// doctorCheck 单项检查的结果，Fix为出问题时的修复方法
+type doctorCheck struct {
+	Name   string
+	OK     bool
+	Warn   bool // 不影响构建本机插件的问题
+	Detail string
+	Fix    string
+}
+
+// 常见交叉编译目标对应的C交叉编译器与安装方法
+var crossCompilers = map[string]struct{ cc, install string }{
+	"windows/amd64": {"x86_64-w64-mingw32-gcc", "install mingw-w64 (apt install gcc-mingw-w64-x86-64, brew install mingw-w64)"},
+	"windows/386":   {"i686-w64-mingw32-gcc", "install mingw-w64 (apt install gcc-mingw-w64-i686, brew install mingw-w64)"},
+	"windows/arm64": {"aarch64-w64-mingw32-gcc", "install llvm-mingw"},
+	"linux/amd64":   {"x86_64-linux-gnu-gcc", "install gcc-x86-64-linux-gnu"},
+	"linux/arm64":   {"aarch64-linux-gnu-gcc", "install gcc-aarch64-linux-gnu"},
+	"linux/arm":     {"arm-linux-gnueabihf-gcc", "install gcc-arm-linux-gnueabihf"},
+	"linux/386":     {"i686-linux-gnu-gcc", "install gcc-i686-linux-gnu"},
+	"darwin/amd64":  {"o64-clang", "build on macOS, or install osxcross"},
+	"darwin/arm64":  {"oa64-clang", "build on macOS, or install osxcross"},
+}
+
+// zig cc的目标名，zig可以作为任意目标的C交叉编译器
+func zigTarget(goos, goarch string) string {
+	arch := map[string]string{"amd64": "x86_64", "386": "x86", "arm64": "aarch64", "arm": "arm"}[goarch]
+	if arch == "" {
+		arch = goarch
+	}
+	abi := map[string]string{"windows": "windows-gnu", "linux": "linux-gnu", "darwin": "macos"}[goos]
+	if abi == "" {
+		abi = goos
+	}
+	return arch + "-" + abi
+}
+
+// runDoctor 实现 builder doctor：检查构建插件所需的环境，为每个问题给出修复方法。有问题时退出码为1
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	goPath := fs.String("gopath", "go", "go binary path to check")
+	targets := fs.String("targets", "", "comma-separated goos/goarch targets to check cross compilers for, "+
+		"e.g. windows/amd64,linux/arm64")
+	manifest := fs.String("manifest", "", "also check the targets and CC settings of a plugins.json manifest")
+	outputDir := fs.String("o", ".", "output directory that must be writable")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder doctor [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// 目标平台到该平台使用的CC，CC为空时按crossCompilers查找
+	targetCC := make(map[string]string)
+	targetOrder := make([]string, 0)
+	addTarget := func(target, cc string) {
+		if _, ok := targetCC[target]; !ok {
+			targetOrder = append(targetOrder, target)
+		}
+		if cc != "" || targetCC[target] == "" {
+			targetCC[target] = cc
+		}
+	}
+	for _, target := range splitToolchains(*targets) {
+		addTarget(target, "")
+	}
+	if *manifest != "" {
+		m, err := loadManifest(*manifest)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, entry := range m.Plugins {
+			for _, target := range entry.Targets {
+				addTarget(target, entry.Env["CC"])
+			}
+		}
+	}
+	checks := doctor(*goPath, targetOrder, targetCC, *outputDir)
+	if !printDoctorChecks(os.Stdout, checks) {
+		os.Exit(1)
+	}
+}
+
+// doctor 依次检查Go工具链、cgo与C编译器、交叉编译器、模板、输出目录与缓存目录
+func doctor(goPath string, targets []string, targetCC map[string]string, outputDir string) []*doctorCheck {
+	checks := make([]*doctorCheck, 0)
+	add := func(check *doctorCheck) {
+		checks = append(checks, check)
+	}
+	tc, err := detectToolchain(goPath, nil)
+	if err != nil {
+		add(&doctorCheck{Name: "go toolchain", Detail: err.Error(),
+			Fix: "install Go from https://go.dev/dl/ and put it on PATH, or pass its path with -gopath"})
+	} else {
+		add(&doctorCheck{Name: "go toolchain", OK: true,
+			Detail: fmt.Sprintf("%s %s/%s (%s)", tc.Version, tc.GOOS, tc.GOARCH, goPath)})
+		checks = append(checks, doctorCgo(tc)...)
+		for _, target := range targets {
+			checks = append(checks, doctorTarget(tc, target, targetCC[target]))
+		}
+	}
+	checks = append(checks, doctorTemplates())
+	add(doctorWritable("output directory", outputDir,
+		"choose a writable directory with -o, or fix the directory's permissions"))
+	if cache, err := openBuildCache(); err != nil {
+		add(&doctorCheck{Name: "build cache", Detail: err.Error(),
+			Fix: "set FUZZGIU_CACHE to a writable directory, or build with -no-cache"})
+	} else {
+		add(doctorWritable("build cache", cache.Dir,
+			"set FUZZGIU_CACHE to a writable directory, or build with -no-cache"))
+	}
+	return checks
+}
+
+// 本机平台的C编译器安装方法
+func ccInstallHint() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "install MinGW-w64 gcc (e.g. from MSYS2: pacman -S mingw-w64-ucrt-x86_64-gcc) and add it to PATH"
+	case "darwin":
+		return "install the Xcode command line tools: xcode-select --install"
+	}
+	return "install gcc (apt install gcc, dnf install gcc, apk add gcc musl-dev)"
+}
+
+// 检查本机的cgo与C编译器，并实际构建一个最小的c-shared动态库
+func doctorCgo(tc *goToolchain) []*doctorCheck {
+	if !tc.CGOEnabled {
+		return []*doctorCheck{{Name: "cgo", Detail: "CGO_ENABLED=0, -buildmode=c-shared needs cgo",
+			Fix: "go env -w CGO_ENABLED=1 (or unset CGO_ENABLED), and make sure a C compiler is installed"}}
+	}
+	checks := []*doctorCheck{{Name: "cgo", OK: true, Detail: "CGO_ENABLED=1"}}
+	version := ccVersion(&buildOptions{}, "", tc.CC)
+	if version == "unknown" {
+		return append(checks, &doctorCheck{Name: "C compiler", Detail: fmt.Sprintf("CC=%q cannot be run", tc.CC),
+			Fix: ccInstallHint() + ", or point CC at an installed compiler (go env -w CC=...)"})
+	}
+	checks = append(checks, &doctorCheck{Name: "C compiler", OK: true, Detail: fmt.Sprintf("%s (%s)", version, tc.CC)})
+	if err := probeCShared(tc.Path, nil); err != nil {
+		return append(checks, &doctorCheck{Name: "c-shared build", Detail: err.Error(),
+			Fix: "make sure the C compiler can link shared libraries, see the error above"})
+	}
+	return append(checks, &doctorCheck{Name: "c-shared build", OK: true, Detail: "built a test library"})
+}
+
+// 检查交叉编译到target（goos/goarch）所需的C编译器，cc为空时按crossCompilers查找
+func doctorTarget(tc *goToolchain, target, cc string) *doctorCheck {
+	name := "target " + target
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) != 2 {
+		return &doctorCheck{Name: name, Detail: "bad target, expected goos/goarch", Fix: "use a target such as windows/amd64"}
+	}
+	goos, goarch := parts[0], parts[1]
+	known, isKnown := crossCompilers[target]
+	if cc == "" {
+		if goos == tc.GOOS && goarch == tc.GOARCH {
+			cc = tc.CC
+		} else if isKnown {
+			cc = known.cc
+		}
+	}
+	zig := fmt.Sprintf("or use zig as the C compiler: CC=\"zig cc -target %s\"", zigTarget(goos, goarch))
+	install := "install a C cross compiler for " + target
+	if isKnown {
+		install = known.install
+	}
+	if cc == "" {
+		return &doctorCheck{Name: name, Warn: true, Detail: "no known C cross compiler",
+			Fix: install + " and set CC for this target (\"env\": {\"CC\": ...} in the manifest), " + zig}
+	}
+	if _, err := exec.LookPath(strings.Fields(cc)[0]); err != nil {
+		return &doctorCheck{Name: name, Warn: true, Detail: fmt.Sprintf("C compiler %q not found", cc),
+			Fix: install + ", " + zig}
+	}
+	env := []string{"GOOS=" + goos, "GOARCH=" + goarch, "CGO_ENABLED=1", "CC=" + cc}
+	if err := probeCShared(tc.Path, env); err != nil {
+		return &doctorCheck{Name: name, Warn: true, Detail: err.Error(),
+			Fix: fmt.Sprintf("check that %q targets %s, %s", cc, target, zig)}
+	}
+	if goos == tc.GOOS && goarch == tc.GOARCH {
+		return &doctorCheck{Name: name, OK: true, Detail: fmt.Sprintf("native, CC=%q", cc)}
+	}
+	return &doctorCheck{Name: name, OK: true,
+		Detail: fmt.Sprintf("CC=%q (set \"env\": {\"CC\": %q} for this target in the manifest)", cc, cc)}
+}
+
+// 在临时模块中构建一个最小的c-shared动态库
+func probeCShared(goPath string, env []string) error {
+	dir, err := os.MkdirTemp("", "fuzzgiu-doctor")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":  "module fuzzgiudoctor\n",
+		"main.go": "package main\n\nimport \"C\"\n\n//export FuzzGIUDoctor\nfunc FuzzGIUDoctor() {}\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	cmd := exec.Command(goPath, "build", "-buildmode=c-shared", "-o", "doctor.lib", ".")
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), env...), "GOFLAGS=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return goCommandError("go build", err, output)
+	}
+	return nil
+}
+
+// 检查模板目录与gen生成的插件引用的fuzzTypes SDK，均按当前目录查找
+func doctorTemplates() *doctorCheck {
+	names := []string{"templates/plugin.gotmp", "templates/pluginTest.gotmp", "templates/pluginReadme.mdtmp",
+		"templates/harness.gotmp", "fuzzTypes/go.mod"}
+	for _, p := range abi.Plugins {
+		names = append(names, getTemplateFileName(p.Type, false), getTemplateFileName(p.Type, true))
+	}
+	missing := make([]string, 0)
+	for _, name := range names {
+		if _, err := os.Stat(name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		wd, _ := os.Getwd()
+		return &doctorCheck{Name: "templates", Detail: fmt.Sprintf("missing in %s: %s", wd, strings.Join(missing, ", ")),
+			Fix: "run the builder from the directory that contains templates/ (the builder's source directory), " +
+				"or regenerate the wrapper templates there with builder abi"}
+	}
+	return &doctorCheck{Name: "templates", OK: true, Detail: fmt.Sprintf("%d templates found", len(names))}
+}
+
+// 检查目录是否可写，目录不存在时检查能否创建
+func doctorWritable(name, dir, fix string) *doctorCheck {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &doctorCheck{Name: name, Detail: err.Error(), Fix: fix}
+	}
+	f, err := os.CreateTemp(dir, ".fuzzgiu-doctor")
+	if err != nil {
+		return &doctorCheck{Name: name, Detail: fmt.Sprintf("%s is not writable: %v", dir, err), Fix: fix}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	abs, _ := filepath.Abs(dir)
+	return &doctorCheck{Name: name, OK: true, Detail: abs + " is writable"}
+}
+
+// 输出检查结果，返回是否没有FAIL（WARN不算失败）
+func printDoctorChecks(out io.Writer, checks []*doctorCheck) bool {
+	failed, warned := 0, 0
+	for _, check := range checks {
+		status := "ok  "
+		switch {
+		case check.OK:
+		case check.Warn:
+			status = "WARN"
+			warned++
+		default:
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(out, "%s %-22s %s\n", status, check.Name, strings.Replace(check.Detail, "\n", "\n     ", -1))
+		if !check.OK && check.Fix != "" {
+			fmt.Fprintf(out, "     fix: %s\n", check.Fix)
+		}
+	}
+	switch {
+	case failed > 0:
+		fmt.Fprintf(out, "%d problems, %d warnings\n", failed, warned)
+	case warned > 0:
+		fmt.Fprintf(out, "ready to build plugins for this platform, %d warnings\n", warned)
+	default:
+		fmt.Fprintln(out, "ready to build plugins")
+	}
+	return failed == 0
+}
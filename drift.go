@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fuzzTypes漂移检查：插件引用的fuzzTypes包（旧版本复制的fuzzTypes.go，或其他版本的SDK）与构建器中的SDK不一致时，
+// FuzzGIU以JSON传入的字段会被插件忽略而得到零值，插件返回的字段FuzzGIU也无法识别。
+// 构建时用go/types比较两者导出的结构体字段（按JSON名称对应）、字段类型与常量的值
+
+// checkFuzzTypesDrift 比较插件在dir中引用的fuzzTypes包与构建器中的SDK，返回差异的诊断信息：
+// 缺少的类型与字段、改名的JSON tag、类型或常量值的变化为error，插件中多出的字段为warning。
+// 插件没有引用fuzzTypes，或引用的就是构建器中的SDK时返回nil
+func checkFuzzTypesDrift(opt *buildOptions, dir string, src *pluginSource) ([]*diagnostic, error) {
+	imports := fuzzTypesImports(src)
+	if len(imports) == 0 {
+		return nil, nil
+	}
+	sdk, err := sdkDir()
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	plugin, pluginDir, err := loadExportedPackage(fset, opt.GoPath, dir, opt.buildEnv(), opt.modFlags(), imports[0])
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Clean(pluginDir) == sdk {
+		return nil, nil
+	}
+	// SDK没有依赖，在其自身的模块中加载，不受插件所在工作区的影响
+	canonical, _, err := loadExportedPackage(fset, opt.GoPath, sdk, append(opt.buildEnv(), "GOWORK=off"), nil, fuzzTypesModule)
+	if err != nil {
+		return nil, err
+	}
+	return compareFuzzTypes(fset, canonical, plugin), nil
+}
+
+// 插件引用的fuzzTypes包的导入路径
+func fuzzTypesImports(src *pluginSource) []string {
+	imports := make([]string, 0)
+	for _, imp := range src.Imports {
+		fields := strings.Fields(imp) // 可能带有包的别名
+		p, err := strconv.Unquote(fields[len(fields)-1])
+		if err == nil && path.Base(p) == "fuzzTypes" {
+			imports = append(imports, p)
+		}
+	}
+	return imports
+}
+
+// loadExportedPackage 在dir中以go list -export编译importPath（不链接），从导出数据中读取其类型信息，同时返回包所在目录
+func loadExportedPackage(fset *token.FileSet, goPath, dir string, env, modFlags []string, importPath string) (*types.Package, string, error) {
+	args := append([]string{"list", "-export", "-deps"}, modFlags...)
+	cmd := exec.Command(goPath, append(args, "-f", "{{.ImportPath}}\t{{.Dir}}\t{{.Export}}", importPath)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, "", goCommandError("go list", err, stderr.Bytes())
+	}
+	exports, pkgDir := make(map[string]string), ""
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		fields := strings.SplitN(lines.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		exports[fields[0]] = fields[2]
+		if fields[0] == importPath {
+			pkgDir = fields[1]
+		}
+	}
+	imp := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if export, ok := exports[path]; ok && export != "" {
+			return os.Open(export)
+		}
+		return nil, fmt.Errorf("no export data for %s", path)
+	})
+	pkg, err := imp.Import(importPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading %s: %v", importPath, err)
+	}
+	return pkg, pkgDir, nil
+}
+
+// compareFuzzTypes 以构建器中的SDK canonical为准比较插件的fuzzTypes包plugin，诊断信息定位到插件副本中的声明
+func compareFuzzTypes(fset *token.FileSet, canonical, plugin *types.Package) []*diagnostic {
+	diags := make([]*diagnostic, 0)
+	report := func(pos token.Pos, severity, format string, args ...interface{}) {
+		d := &diagnostic{Severity: severity, Code: "fuzztypes", Message: fmt.Sprintf(format, args...)}
+		if p := fset.Position(pos); p.IsValid() {
+			d.File, d.Line, d.Column = p.Filename, p.Line, p.Column
+		}
+		diags = append(diags, d)
+	}
+	// 类型以包内的名字表示，使两个包中的同名类型相等
+	typeString := func(t types.Type) string {
+		return types.TypeString(t, func(pkg *types.Package) string {
+			if pkg == canonical || pkg == plugin {
+				return ""
+			}
+			return pkg.Path()
+		})
+	}
+	var compareStruct func(name string, pos token.Pos, want, got *types.Struct)
+	compareStruct = func(name string, pos token.Pos, want, got *types.Struct) {
+		gotFields := make(map[string]int) // JSON名称到字段下标
+		for i := 0; i < got.NumFields(); i++ {
+			if key := jsonFieldName(got.Field(i), got.Tag(i)); key != "" {
+				gotFields[key] = i
+			}
+		}
+		seen := make(map[int]bool)
+		for i := 0; i < want.NumFields(); i++ {
+			wf := want.Field(i)
+			key := jsonFieldName(wf, want.Tag(i))
+			if key == "" {
+				continue
+			}
+			field := name + "." + wf.Name()
+			j, ok := gotFields[key]
+			if !ok {
+				renamed := false
+				for k := 0; k < got.NumFields(); k++ {
+					if gf := got.Field(k); gf.Name() == wf.Name() {
+						report(gf.Pos(), "error", "%s: json tag %q renamed to %q, FuzzGIU's %q is ignored",
+							field, key, jsonFieldName(gf, got.Tag(k)), key)
+						seen[k], renamed = true, true
+						break
+					}
+				}
+				if !renamed {
+					report(pos, "error", "%s: missing, the plugin gets the zero value of %q (%s)",
+						field, key, typeString(wf.Type()))
+				}
+				continue
+			}
+			seen[j] = true
+			gf := got.Field(j)
+			wantStruct, wok := wf.Type().(*types.Struct)
+			gotStruct, gok := gf.Type().(*types.Struct)
+			if wok && gok { // 匿名结构体逐个字段比较
+				compareStruct(field, gf.Pos(), wantStruct, gotStruct)
+				continue
+			}
+			if w, g := typeString(wf.Type()), typeString(gf.Type()); w != g {
+				report(gf.Pos(), "error", "%s: type %s, FuzzGIU uses %s", field, g, w)
+			}
+		}
+		for k := 0; k < got.NumFields(); k++ {
+			if gf := got.Field(k); !seen[k] && jsonFieldName(gf, got.Tag(k)) != "" {
+				report(gf.Pos(), "warning", "%s.%s: not in FuzzGIU's fuzzTypes, always the zero value", name, gf.Name())
+			}
+		}
+	}
+	names := canonical.Scope().Names() // 已排序
+	for _, name := range names {
+		want := canonical.Scope().Lookup(name)
+		if !want.Exported() {
+			continue
+		}
+		got := plugin.Scope().Lookup(name)
+		switch want := want.(type) {
+		case *types.TypeName:
+			gotType, ok := got.(*types.TypeName)
+			if !ok {
+				if _, used := want.Type().Underlying().(*types.Struct); used {
+					report(token.NoPos, "error", "%s: missing, FuzzGIU's struct %s is not in the plugin's fuzzTypes", name, name)
+				}
+				continue
+			}
+			wantStruct, wok := want.Type().Underlying().(*types.Struct)
+			gotStruct, gok := gotType.Type().Underlying().(*types.Struct)
+			if wok && gok {
+				compareStruct(name, gotType.Pos(), wantStruct, gotStruct)
+			} else if w, g := typeString(want.Type().Underlying()), typeString(gotType.Type().Underlying()); w != g {
+				report(gotType.Pos(), "error", "%s: type %s, FuzzGIU uses %s", name, g, w)
+			}
+		case *types.Const:
+			if gotConst, ok := got.(*types.Const); ok && gotConst.Val().ExactString() != want.Val().ExactString() {
+				report(gotConst.Pos(), "error", "%s: value %s, FuzzGIU uses %s", name,
+					gotConst.Val().ExactString(), want.Val().ExactString())
+			}
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Severity < diags[j].Severity })
+	return diags
+}
+
+// 字段在JSON中的名称，不参与编解码的字段（未导出或tag为"-"）返回空串
+func jsonFieldName(field *types.Var, tag string) string {
+	if !field.Exported() {
+		return ""
+	}
+	name := strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name()
+	}
+	return name
+}
+
+// 漂移检查的结果：有error且opt.FuzzTypesDrift不为warn时返回包含全部差异的错误，否则将差异作为warning输出
+func fuzzTypesDriftError(opt *buildOptions, diags []*diagnostic, out io.Writer) error {
+	failed := false
+	for _, d := range diags {
+		failed = failed || d.Severity == "error" && opt.FuzzTypesDrift != "warn"
+	}
+	if failed {
+		lines := make([]string, 0, len(diags))
+		for _, d := range diags {
+			lines = append(lines, "  "+d.Severity+": "+diagnosticString(d))
+		}
+		return &builderError{Code: exitSignature, Diagnostics: diags, Err: fmt.Errorf("the plugin's fuzzTypes is "+
+			"incompatible with FuzzGIU's, update it with builder -gen <plugin dir> -update "+
+			"(or build with -fuzztypes-drift warn):\n%s", strings.Join(lines, "\n"))}
+	}
+	for _, d := range diags {
+		d.Severity = "warning"
+		fmt.Fprintf(out, "warning: %s\n", diagnosticString(d))
+		opt.Events.emit(&buildEvent{Event: "diagnostic", Stage: "wrap", Plugin: opt.PluginPath,
+			Target: opt.Target, Diagnostic: d})
+	}
+	return nil
+}
+
+// 诊断信息的文本形式 file:line: message
+func diagnosticString(d *diagnostic) string {
+	if d.File == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
@@ -67,3 +67,21 @@ func copyFileToDir(srcFile, destDir string) error {
 
 	return nil
 }
+
+// 复制文件，目标文件已存在时覆盖
+func copyFile(srcFile, destFile string) error {
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
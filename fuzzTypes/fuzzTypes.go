@@ -27,6 +27,11 @@ type (
 		HttpRedirectChain string         `json:"http_redirect_chain"`
 		RawResponse       []byte         `json:"raw_response"`
 		ErrMsg            string         `json:"-"` // error位标记在发包过程是否有出错
+		// 以下字段可以序列化，传给reactor。reqSender插件不需要填写，包装函数在编码前根据HttpResponse与ErrMsg填写
+		StatusCode int         `json:"status_code"` // HTTP状态码，没有收到响应时为0
+		Proto      string      `json:"proto"`       // 响应的协议版本，如HTTP/1.1
+		Headers    http.Header `json:"headers"`     // 响应头
+		Error      string      `json:"error"`       // 发包过程中的错误，即ErrMsg
 	}
 	// Reaction 响应
 	Reaction struct {
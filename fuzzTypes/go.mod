@@ -0,0 +1,3 @@
+module FuzzGIUPluginBuilder/fuzzTypes
+
+go 1.16
@@ -0,0 +1,187 @@
+// Package reactSDK 按FuzzGIU引擎的语义以Filter与Matcher评估响应，供自定义reactor使用，
+// 返回ReactFlagFiltered、ReactFlagMatch与ReactError标志位。
+//
+// 单个条件：
+//
+//	Code   resp.StatusCode在列表中（StatusCode为0时使用HttpResponse.StatusCode）
+//	Lines  resp.Lines在列表中
+//	Words  resp.Words在列表中
+//	Size   resp.Size在列表中
+//	Regex  正则匹配resp.RawResponse
+//	Time   DownBound <= resp.ResponseTime <= UpBound，为0的边界不限制
+//
+// 列表为空、Regex为空、Time的两个边界都为0的条件没有设置，不参与评估。
+// Mode为and时所有设置了的条件都满足才命中，为or或空时任一条件满足即命中；没有设置任何条件的Rule不命中。
+//
+// 标志位：
+//
+//	发包出错（Error或ErrMsg不为空）   ReactError，报告给引擎，不参与过滤与匹配
+//	发包出错且IgnoreError           ReactFlagFiltered，丢弃该响应
+//	Filter命中                     ReactFlagFiltered，不再评估Matcher
+//	Filter未命中，Matcher命中        ReactFlagMatch
+//	都未命中                        0
+package reactSDK
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+)
+
+// Rule 过滤或匹配的条件，与fuzzTypes.Fuzz.React.Filter、Matcher的结构相同，可以直接转换：
+//
+//	rule := reactSDK.Rule(job.React.Matcher)
+type Rule struct {
+	Code  []int  `json:"code"`
+	Lines []int  `json:"lines"`
+	Words []int  `json:"words"`
+	Size  []int  `json:"size"`
+	Regex string `json:"regex"`
+	Mode  string `json:"mode"`
+	Time  struct {
+		DownBound time.Duration `json:"down_bound"`
+		UpBound   time.Duration `json:"up_bound"`
+	} `json:"time"`
+}
+
+// IsZero 是否没有设置任何条件
+func (r *Rule) IsZero() bool {
+	return len(r.Code) == 0 && len(r.Lines) == 0 && len(r.Words) == 0 && len(r.Size) == 0 &&
+		r.Regex == "" && r.Time.DownBound == 0 && r.Time.UpBound == 0
+}
+
+// Compile 检查Mode并编译Regex
+func (r Rule) Compile() (*Compiled, error) {
+	c := &Compiled{rule: r}
+	switch strings.ToLower(r.Mode) {
+	case "", "or":
+	case "and":
+		c.and = true
+	default:
+		return nil, fmt.Errorf("unknown mode %q, want and or or", r.Mode)
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %v", r.Regex, err)
+		}
+		c.re = re
+	}
+	if r.Time.UpBound != 0 && r.Time.DownBound > r.Time.UpBound {
+		return nil, fmt.Errorf("time down bound %v is greater than up bound %v", r.Time.DownBound, r.Time.UpBound)
+	}
+	return c, nil
+}
+
+// Compiled 编译后的Rule，可以被多个协程同时使用
+type Compiled struct {
+	rule Rule
+	re   *regexp.Regexp
+	and  bool
+}
+
+// Match resp是否命中规则，不检查resp是否发包出错
+func (c *Compiled) Match(resp *fuzzTypes.Resp) bool {
+	conditions := make([]bool, 0, 6)
+	if len(c.rule.Code) > 0 {
+		conditions = append(conditions, contains(c.rule.Code, statusCode(resp)))
+	}
+	if len(c.rule.Lines) > 0 {
+		conditions = append(conditions, contains(c.rule.Lines, resp.Lines))
+	}
+	if len(c.rule.Words) > 0 {
+		conditions = append(conditions, contains(c.rule.Words, resp.Words))
+	}
+	if len(c.rule.Size) > 0 {
+		conditions = append(conditions, contains(c.rule.Size, resp.Size))
+	}
+	if c.re != nil {
+		conditions = append(conditions, c.re.Match(resp.RawResponse))
+	}
+	if down, up := c.rule.Time.DownBound, c.rule.Time.UpBound; down != 0 || up != 0 {
+		conditions = append(conditions, (down == 0 || resp.ResponseTime >= down) && (up == 0 || resp.ResponseTime <= up))
+	}
+	if len(conditions) == 0 {
+		return false
+	}
+	for _, ok := range conditions {
+		if ok != c.and { // and模式下有一个不满足即不命中，or模式下有一个满足即命中
+			return ok
+		}
+	}
+	return c.and
+}
+
+// Evaluator 一组Filter与Matcher，可以被多个协程同时使用
+type Evaluator struct {
+	// IgnoreError 与fuzzTypes.Fuzz.React.IgnoreError相同，为true时丢弃发包出错的响应，否则以ReactError报告
+	IgnoreError bool
+
+	filter  *Compiled
+	matcher *Compiled
+}
+
+// NewEvaluator 编译filter与matcher
+func NewEvaluator(filter, matcher Rule) (*Evaluator, error) {
+	f, err := filter.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("filter: %v", err)
+	}
+	m, err := matcher.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("matcher: %v", err)
+	}
+	return &Evaluator{filter: f, matcher: m}, nil
+}
+
+// FromFuzz 使用任务中设置的Filter、Matcher与IgnoreError
+func FromFuzz(job *fuzzTypes.Fuzz) (*Evaluator, error) {
+	e, err := NewEvaluator(Rule(job.React.Filter), Rule(job.React.Matcher))
+	if err != nil {
+		return nil, err
+	}
+	e.IgnoreError = job.React.IgnoreError
+	return e, nil
+}
+
+// Flags 评估resp，返回ReactError、ReactFlagFiltered、ReactFlagMatch或0
+func (e *Evaluator) Flags(resp *fuzzTypes.Resp) uint32 {
+	if resp == nil || resp.Error != "" || resp.ErrMsg != "" {
+		if e.IgnoreError {
+			return fuzzTypes.ReactFlagFiltered
+		}
+		return fuzzTypes.ReactError
+	}
+	if e.filter.Match(resp) {
+		return fuzzTypes.ReactFlagFiltered
+	}
+	if e.matcher.Match(resp) {
+		return fuzzTypes.ReactFlagMatch
+	}
+	return 0
+}
+
+// React 以Flags的结果作为标志位生成Reaction，reactor可以在此基础上修改
+func (e *Evaluator) React(resp *fuzzTypes.Resp) *fuzzTypes.Reaction {
+	return &fuzzTypes.Reaction{Flag: e.Flags(resp)}
+}
+
+// 响应的状态码，reqSender插件在进程内构造的Resp可能只设置了HttpResponse
+func statusCode(resp *fuzzTypes.Resp) int {
+	if resp.StatusCode == 0 && resp.HttpResponse != nil {
+		return resp.HttpResponse.StatusCode
+	}
+	return resp.StatusCode
+}
+
+func contains(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
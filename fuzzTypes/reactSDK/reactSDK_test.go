@@ -0,0 +1,185 @@
+package reactSDK
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+)
+
+// 带有时间范围的Rule
+func withTime(r Rule, down, up time.Duration) Rule {
+	r.Time.DownBound, r.Time.UpBound = down, up
+	return r
+}
+
+// 用例中的响应：状态码200，3行5个词，大小42，耗时100ms
+func okResp() *fuzzTypes.Resp {
+	return &fuzzTypes.Resp{StatusCode: 200, Lines: 3, Words: 5, Size: 42,
+		RawResponse: []byte("welcome, admin"), ResponseTime: 100 * time.Millisecond}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		resp *fuzzTypes.Resp
+		want bool
+	}{
+		{"zero rule", Rule{}, okResp(), false},
+		{"code hit", Rule{Code: []int{301, 200}}, okResp(), true},
+		{"code miss", Rule{Code: []int{404}}, okResp(), false},
+		{"lines hit", Rule{Lines: []int{3}}, okResp(), true},
+		{"lines miss", Rule{Lines: []int{4}}, okResp(), false},
+		{"words hit", Rule{Words: []int{5}}, okResp(), true},
+		{"words miss", Rule{Words: []int{6}}, okResp(), false},
+		{"size hit", Rule{Size: []int{0, 42}}, okResp(), true},
+		{"size miss", Rule{Size: []int{41}}, okResp(), false},
+		{"regex hit", Rule{Regex: `admin$`}, okResp(), true},
+		{"regex miss", Rule{Regex: `^admin`}, okResp(), false},
+		{"time both bounds inside", withTime(Rule{}, 50*time.Millisecond, 200*time.Millisecond), okResp(), true},
+		{"time both bounds inclusive", withTime(Rule{}, 100*time.Millisecond, 100*time.Millisecond), okResp(), true},
+		{"time both bounds outside", withTime(Rule{}, 150*time.Millisecond, 200*time.Millisecond), okResp(), false},
+		{"time down bound only hit", withTime(Rule{}, 100*time.Millisecond, 0), okResp(), true},
+		{"time down bound only miss", withTime(Rule{}, 101*time.Millisecond, 0), okResp(), false},
+		{"time up bound only hit", withTime(Rule{}, 0, 100*time.Millisecond), okResp(), true},
+		{"time up bound only miss", withTime(Rule{}, 0, 99*time.Millisecond), okResp(), false},
+		{"empty mode is or", Rule{Code: []int{404}, Size: []int{42}}, okResp(), true},
+		{"or one hit", Rule{Code: []int{404}, Size: []int{42}, Mode: "or"}, okResp(), true},
+		{"or none hit", Rule{Code: []int{404}, Size: []int{1}, Mode: "or"}, okResp(), false},
+		{"and all hit", Rule{Code: []int{200}, Size: []int{42}, Regex: "admin", Mode: "and"}, okResp(), true},
+		{"and one miss", Rule{Code: []int{200}, Size: []int{1}, Mode: "and"}, okResp(), false},
+		{"and mode is case-insensitive", Rule{Code: []int{200}, Size: []int{1}, Mode: "AND"}, okResp(), false},
+		{"and with time", withTime(Rule{Code: []int{200}, Mode: "and"}, 0, 50*time.Millisecond), okResp(), false},
+		{"code falls back to HttpResponse", Rule{Code: []int{302}},
+			&fuzzTypes.Resp{HttpResponse: &http.Response{StatusCode: 302}}, true},
+		{"StatusCode wins over HttpResponse", Rule{Code: []int{302}},
+			&fuzzTypes.Resp{StatusCode: 200, HttpResponse: &http.Response{StatusCode: 302}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.rule.Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Match(tt.resp); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsZero(t *testing.T) {
+	if r := (Rule{Mode: "and"}); !r.IsZero() {
+		t.Error("a rule with only a mode should be zero")
+	}
+	if r := withTime(Rule{}, 0, time.Second); r.IsZero() {
+		t.Error("a rule with a time bound should not be zero")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"bad mode", Rule{Mode: "xor"}, "unknown mode"},
+		{"bad regex", Rule{Regex: "("}, "invalid regex"},
+		{"down bound over up bound", withTime(Rule{}, 2*time.Second, time.Second), "greater than up bound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rule.Compile()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Compile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := NewEvaluator(Rule{}, Rule{Regex: "("}); err == nil || !strings.HasPrefix(err.Error(), "matcher: ") {
+		t.Errorf("NewEvaluator() error = %v, want a matcher error", err)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	errored := okResp()
+	errored.Error = "connection refused"
+	erroredMsg := okResp()
+	erroredMsg.ErrMsg = "connection refused"
+	tests := []struct {
+		name        string
+		filter      Rule
+		matcher     Rule
+		ignoreError bool
+		resp        *fuzzTypes.Resp
+		want        uint32
+	}{
+		{"no rules", Rule{}, Rule{}, false, okResp(), 0},
+		{"matched", Rule{}, Rule{Code: []int{200}}, false, okResp(), fuzzTypes.ReactFlagMatch},
+		{"filtered", Rule{Size: []int{42}}, Rule{}, false, okResp(), fuzzTypes.ReactFlagFiltered},
+		{"filter takes precedence", Rule{Size: []int{42}}, Rule{Code: []int{200}}, false, okResp(),
+			fuzzTypes.ReactFlagFiltered},
+		{"filter miss matcher hit", Rule{Size: []int{1}}, Rule{Code: []int{200}}, false, okResp(),
+			fuzzTypes.ReactFlagMatch},
+		{"neither", Rule{Size: []int{1}}, Rule{Code: []int{404}}, false, okResp(), 0},
+		{"Error reported", Rule{}, Rule{Code: []int{200}}, false, errored, fuzzTypes.ReactError},
+		{"ErrMsg reported", Rule{}, Rule{Code: []int{200}}, false, erroredMsg, fuzzTypes.ReactError},
+		{"nil resp reported", Rule{}, Rule{}, false, nil, fuzzTypes.ReactError},
+		{"Error ignored", Rule{}, Rule{Code: []int{200}}, true, errored, fuzzTypes.ReactFlagFiltered},
+		{"ErrMsg ignored", Rule{}, Rule{Code: []int{200}}, true, erroredMsg, fuzzTypes.ReactFlagFiltered},
+		{"ignore error keeps good responses", Rule{}, Rule{Code: []int{200}}, true, okResp(),
+			fuzzTypes.ReactFlagMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEvaluator(tt.filter, tt.matcher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.IgnoreError = tt.ignoreError
+			if got := e.Flags(tt.resp); got != tt.want {
+				t.Errorf("Flags() = %#x, want %#x", got, tt.want)
+			}
+			if got := e.React(tt.resp).Flag; got != tt.want {
+				t.Errorf("React().Flag = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromFuzz(t *testing.T) {
+	job := new(fuzzTypes.Fuzz)
+	job.React.Filter.Code = []int{404}
+	job.React.Matcher.Regex = "admin"
+	job.React.Matcher.Time.UpBound = time.Second
+	job.React.IgnoreError = true
+	e, err := FromFuzz(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.IgnoreError {
+		t.Error("IgnoreError not taken from the job")
+	}
+	notFound := okResp()
+	notFound.StatusCode = 404
+	errored := okResp()
+	errored.ErrMsg = "timeout"
+	for _, c := range []struct {
+		resp *fuzzTypes.Resp
+		want uint32
+	}{
+		{okResp(), fuzzTypes.ReactFlagMatch},
+		{notFound, fuzzTypes.ReactFlagFiltered},
+		{errored, fuzzTypes.ReactFlagFiltered},
+	} {
+		if got := e.Flags(c.resp); got != c.want {
+			t.Errorf("Flags(code %d, err %q) = %#x, want %#x", c.resp.StatusCode, c.resp.ErrMsg, got, c.want)
+		}
+	}
+	job.React.Matcher.Mode = "nand"
+	if _, err = FromFuzz(job); err == nil {
+		t.Error("FromFuzz accepted an invalid matcher mode")
+	}
+}
@@ -0,0 +1,296 @@
+// Package sendSDK 是reqSender插件的参考实现：按SendMeta的全部字段以net/http发送请求并填写Resp，
+// 自定义sender可以直接调用Send，或设置Sender的字段在此基础上扩展。
+//
+// SendMeta字段的处理：
+//
+//	Request.URL               请求的URL，HttpSpec.ForceHttps为true时scheme改为https
+//	Request.HttpSpec.Method   请求方法，为空时为GET
+//	Request.HttpSpec.Headers  "Name: value"形式的请求头，Host头设置请求的Host
+//	Request.HttpSpec.Version  HTTP/1.0或HTTP/1.1时只使用HTTP/1.1，HTTP/2或空时对https尝试HTTP/2
+//	Request.Data              请求体
+//	Proxy                     代理，支持http、https与socks5，没有scheme时为http，为空时不使用代理
+//	HttpFollowRedirects       是否跟随重定向，连同最初的请求最多发送10个请求，超过时返回最后一个重定向响应
+//	Timeout                   超时时间（秒），包括读取响应体，为0时不限制
+//	Retry                     重试次数，最多发送Retry+1次，返回最后一次的结果
+//	RetryCode                 状态码为其中之一时重试，以逗号分隔，可以是范围，如 429,500-599
+//	RetryRegex                响应体匹配正则时重试
+//
+// 发送出错（连接失败、超时、读取响应体失败等）时也会重试；URL、请求头有误或Prepare返回错误时请求无法构造，不会重试。
+// 读取响应体失败时只返回错误，不填写下列响应的字段。填写的Resp：
+//
+//	HttpResponse       最后一个响应，Body已读完并替换为可以重新读取的副本
+//	ResponseTime       从发送请求到读完响应体的时间
+//	Size Words Lines   响应体的字节数、以空白分隔的词数与行数（换行符数加1，响应体为空时为0）
+//	RawResponse        响应体
+//	HttpRedirectChain  跟随了重定向时，依次请求的URL以 -> 连接，否则为空
+//	StatusCode Proto Headers  响应的状态码、协议版本与响应头
+//	ErrMsg Error       发送失败的原因，成功时为空
+//
+// https不校验服务端证书。
+package sendSDK
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+)
+
+// 跟随重定向的最大次数，与net/http相同
+const maxRedirects = 10
+
+// Sender 发送请求。零值即可使用，可以被多个协程同时使用，字段应在开始发送前设置
+type Sender struct {
+	// Transport 发送请求使用的RoundTripper，为nil时按SendMeta的Proxy与HttpSpec.Version创建，并缓存以复用连接
+	Transport http.RoundTripper
+	// Prepare 在每次发送（包括重试）前调用，可以修改请求，如添加签名或认证头。返回错误时不再发送也不重试，错误写入ErrMsg
+	Prepare func(request *http.Request, meta *fuzzTypes.SendMeta) error
+	// Retry 一次发送后是否重试，retry为按SendMeta判断的结果，为nil时即使用retry。达到Retry次数后不再调用
+	Retry func(resp *fuzzTypes.Resp, meta *fuzzTypes.SendMeta, retry bool) bool
+
+	transports sync.Map // proxy与HTTP版本到*http.Transport
+}
+
+// Default Send使用的Sender
+var Default = new(Sender)
+
+// Send 以Default发送meta中的请求
+func Send(meta *fuzzTypes.SendMeta) *fuzzTypes.Resp {
+	return Default.Send(meta)
+}
+
+// Send 发送meta中的请求
+func (s *Sender) Send(meta *fuzzTypes.SendMeta) *fuzzTypes.Resp {
+	return s.SendContext(context.Background(), meta)
+}
+
+// SendContext 发送meta中的请求，ctx取消时停止发送与重试
+func (s *Sender) SendContext(ctx context.Context, meta *fuzzTypes.SendMeta) *fuzzTypes.Resp {
+	resp := new(fuzzTypes.Resp)
+	if err := s.send(ctx, meta, resp); err != nil {
+		resp.ErrMsg, resp.Error = err.Error(), err.Error()
+	}
+	return resp
+}
+
+func (s *Sender) send(ctx context.Context, meta *fuzzTypes.SendMeta, resp *fuzzTypes.Resp) error {
+	if meta == nil || meta.Request == nil {
+		return fmt.Errorf("no request to send")
+	}
+	codes, err := parseRetryCode(meta.RetryCode)
+	if err != nil {
+		return err
+	}
+	var retryRe *regexp.Regexp
+	if meta.RetryRegex != "" {
+		if retryRe, err = regexp.Compile(meta.RetryRegex); err != nil {
+			return fmt.Errorf("invalid retry_regex %q: %v", meta.RetryRegex, err)
+		}
+	}
+	transport := s.Transport
+	if transport == nil {
+		if transport, err = s.transport(meta.Proxy, meta.Request.HttpSpec.Version); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		*resp = fuzzTypes.Resp{}
+		request, err := s.newRequest(ctx, meta)
+		if err != nil { // 请求本身有误，重试也不会成功
+			return err
+		}
+		if err = s.do(transport, meta, request, resp); err != nil {
+			resp.ErrMsg, resp.Error = err.Error(), err.Error()
+		}
+		if attempt >= meta.Retry || ctx.Err() != nil {
+			return nil
+		}
+		retry := err != nil || codes.contains(resp.StatusCode) || retryRe != nil && retryRe.Match(resp.RawResponse)
+		if s.Retry != nil {
+			retry = s.Retry(resp, meta, retry)
+		}
+		if !retry {
+			return nil
+		}
+	}
+}
+
+// 构造一次发送的请求并调用Prepare，每次重试都重新构造，使请求体可以再次读取
+func (s *Sender) newRequest(ctx context.Context, meta *fuzzTypes.SendMeta) (*http.Request, error) {
+	request, err := NewRequest(meta.Request)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	if s.Prepare != nil {
+		if err = s.Prepare(request, meta); err != nil {
+			return nil, err
+		}
+	}
+	return request, nil
+}
+
+// 发送一次请求，读完响应体后填写resp，出错时resp保持为空
+func (s *Sender) do(transport http.RoundTripper, meta *fuzzTypes.SendMeta, request *http.Request, resp *fuzzTypes.Resp) error {
+	chain := make([]string, 0)
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(meta.Timeout) * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !meta.HttpFollowRedirects || len(via) >= maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(chain) == 0 {
+				chain = append(chain, via[0].URL.String())
+			}
+			chain = append(chain, req.URL.String())
+			return nil
+		},
+	}
+	start := time.Now()
+	httpResp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	resp.ResponseTime = time.Since(start)
+	httpResp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.HttpResponse = httpResp
+	resp.StatusCode, resp.Proto, resp.Headers = httpResp.StatusCode, httpResp.Proto, httpResp.Header
+	resp.HttpRedirectChain = strings.Join(chain, " -> ")
+	FillBody(resp, body)
+	return nil
+}
+
+// NewRequest 由req构造http.Request：URL（ForceHttps时改为https）、方法、请求头与请求体
+func NewRequest(req *fuzzTypes.Req) (*http.Request, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if req.HttpSpec.ForceHttps {
+		u.Scheme = "https"
+	}
+	method := req.HttpSpec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if req.Data != "" {
+		body = strings.NewReader(req.Data)
+	}
+	request, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range req.HttpSpec.Headers {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid header %q, want \"Name: value\"", header)
+		}
+		name, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if strings.EqualFold(name, "Host") {
+			request.Host = value
+			continue
+		}
+		request.Header.Add(name, value)
+	}
+	return request, nil
+}
+
+// FillBody 以响应体填写RawResponse、Size、Words与Lines，不使用net/http的sender也可以用它得到相同的统计
+func FillBody(resp *fuzzTypes.Resp, body []byte) {
+	resp.RawResponse = body
+	resp.Size = len(body)
+	resp.Words = len(bytes.Fields(body))
+	resp.Lines = 0
+	if len(body) > 0 {
+		resp.Lines = bytes.Count(body, []byte("\n")) + 1
+	}
+}
+
+// 按代理与HTTP版本创建的Transport
+func (s *Sender) transport(proxy, version string) (http.RoundTripper, error) {
+	key := proxy + "\x00" + version
+	if t, ok := s.transports.Load(key); ok {
+		return t.(*http.Transport), nil
+	}
+	t := &http.Transport{
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	switch strings.ToUpper(version) {
+	case "", "HTTP/2", "HTTP/2.0", "2":
+		t.ForceAttemptHTTP2 = true
+	case "HTTP/1.0", "HTTP/1.1", "1.0", "1.1":
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper) // 不协商HTTP/2
+	default:
+		return nil, fmt.Errorf("unsupported HTTP version %q", version)
+	}
+	if proxy != "" {
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %v", proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	actual, _ := s.transports.LoadOrStore(key, t)
+	return actual.(*http.Transport), nil
+}
+
+// 需要重试的状态码范围
+type codeRanges [][2]int
+
+func (r codeRanges) contains(code int) bool {
+	for _, c := range r {
+		if code >= c[0] && code <= c[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析RetryCode，如 429,500-599
+func parseRetryCode(s string) (codeRanges, error) {
+	ranges := make(codeRanges, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		low, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		high := low
+		if err == nil && len(bounds) == 2 {
+			high, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if err != nil || low > high {
+			return nil, fmt.Errorf("invalid retry_code %q, want codes or ranges such as 429,500-599", s)
+		}
+		ranges = append(ranges, [2]int{low, high})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,422 @@
+package sendSDK
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+)
+
+// 测试用的服务端，hits记录收到的请求数
+type testServer struct {
+	*httptest.Server
+	hits int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := new(testServer)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s\nhost=%s x=%s\n%s", r.Method, r.Proto, r.Host, r.Header.Get("X-Test"), body)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+	})
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+		w.WriteHeader(code)
+		io.WriteString(w, "status "+strconv.Itoa(code))
+	})
+	// 前n个请求返回503，之后返回200
+	mux.HandleFunc("/flaky/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/flaky/"))
+		if int(atomic.AddInt32(&s.hits, 1)) <= n {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "server busy")
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	// 前n个请求直接断开连接
+	mux.HandleFunc("/drop/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/drop/"))
+		if int(atomic.AddInt32(&s.hits, 1)) <= n {
+			panic(http.ErrAbortHandler)
+		}
+		io.WriteString(w, "ok")
+	})
+	// 声明的长度大于实际写入的长度，响应体读到一半连接断开
+	mux.HandleFunc("/truncated", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if n == 0 {
+			io.WriteString(w, "landed")
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) req(path string) *fuzzTypes.Req {
+	return &fuzzTypes.Req{URL: s.URL + path}
+}
+
+func (s *testServer) hitCount() int {
+	return int(atomic.LoadInt32(&s.hits))
+}
+
+func TestRequest(t *testing.T) {
+	s := newTestServer(t)
+	req := s.req("/echo")
+	req.HttpSpec.Method = "PUT"
+	req.HttpSpec.Headers = []string{"X-Test: hello", "Host: example.test"}
+	req.Data = "a=1&b=2"
+	resp := Send(&fuzzTypes.SendMeta{Request: req})
+	if resp.ErrMsg != "" {
+		t.Fatal(resp.ErrMsg)
+	}
+	want := "PUT HTTP/1.1\nhost=example.test x=hello\na=1&b=2"
+	if string(resp.RawResponse) != want {
+		t.Errorf("RawResponse = %q, want %q", resp.RawResponse, want)
+	}
+	if resp.StatusCode != 200 || resp.Proto != "HTTP/1.1" || resp.Headers.Get("Content-Type") == "" {
+		t.Errorf("StatusCode, Proto, Headers = %d, %q, %v", resp.StatusCode, resp.Proto, resp.Headers)
+	}
+	if resp.HttpResponse == nil {
+		t.Fatal("HttpResponse not set")
+	}
+	if body, _ := io.ReadAll(resp.HttpResponse.Body); string(body) != want {
+		t.Errorf("HttpResponse.Body = %q, want it readable again", body)
+	}
+	if resp.ResponseTime <= 0 {
+		t.Errorf("ResponseTime = %v", resp.ResponseTime)
+	}
+
+	get := Send(&fuzzTypes.SendMeta{Request: s.req("/echo")})
+	if !strings.HasPrefix(string(get.RawResponse), "GET ") {
+		t.Errorf("default method: %q", get.RawResponse)
+	}
+}
+
+func TestBadRequestNotRetried(t *testing.T) {
+	s := newTestServer(t)
+	prepared := 0
+	sender := &Sender{Prepare: func(*http.Request, *fuzzTypes.SendMeta) error {
+		prepared++
+		return errors.New("no credentials")
+	}}
+	resp := sender.Send(&fuzzTypes.SendMeta{Request: s.req("/echo"), Retry: 3})
+	if resp.ErrMsg != "no credentials" || resp.Error != resp.ErrMsg {
+		t.Errorf("ErrMsg, Error = %q, %q", resp.ErrMsg, resp.Error)
+	}
+	if prepared != 1 {
+		t.Errorf("Prepare called %d times, want 1", prepared)
+	}
+
+	prepared = 0
+	req := s.req("/echo")
+	req.HttpSpec.Headers = []string{"no colon"}
+	resp = sender.Send(&fuzzTypes.SendMeta{Request: req, Retry: 3})
+	if !strings.Contains(resp.ErrMsg, "invalid header") || prepared != 0 {
+		t.Errorf("ErrMsg = %q, Prepare called %d times", resp.ErrMsg, prepared)
+	}
+
+	resp = Send(&fuzzTypes.SendMeta{Request: &fuzzTypes.Req{URL: "http://[::1"}, Retry: 3})
+	if resp.ErrMsg == "" {
+		t.Error("bad URL accepted")
+	}
+	if s.hitCount() != 0 {
+		t.Errorf("server got %d requests, want none", s.hitCount())
+	}
+	if resp = Send(&fuzzTypes.SendMeta{}); resp.ErrMsg != "no request to send" {
+		t.Errorf("nil request: ErrMsg = %q", resp.ErrMsg)
+	}
+}
+
+func TestForceHttps(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "tls=%v", r.TLS != nil)
+	}))
+	defer tlsServer.Close()
+	req := &fuzzTypes.Req{URL: strings.Replace(tlsServer.URL, "https://", "http://", 1) + "/"}
+	req.HttpSpec.ForceHttps = true
+	resp := Send(&fuzzTypes.SendMeta{Request: req})
+	if resp.ErrMsg != "" || string(resp.RawResponse) != "tls=true" {
+		t.Errorf("RawResponse, ErrMsg = %q, %q", resp.RawResponse, resp.ErrMsg)
+	}
+}
+
+func TestHttpVersion(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	for version, want := range map[string]string{"": "HTTP/2.0", "HTTP/2": "HTTP/2.0", "HTTP/1.1": "HTTP/1.1"} {
+		req := &fuzzTypes.Req{URL: tlsServer.URL}
+		req.HttpSpec.Version = version
+		if resp := Send(&fuzzTypes.SendMeta{Request: req}); string(resp.RawResponse) != want {
+			t.Errorf("version %q: got %q (%s), want %s", version, resp.RawResponse, resp.ErrMsg, want)
+		}
+	}
+	req := &fuzzTypes.Req{URL: tlsServer.URL}
+	req.HttpSpec.Version = "HTTP/3"
+	if resp := Send(&fuzzTypes.SendMeta{Request: req}); !strings.Contains(resp.ErrMsg, "unsupported HTTP version") {
+		t.Errorf("HTTP/3: ErrMsg = %q", resp.ErrMsg)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	s := newTestServer(t)
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/redirect/2")})
+	if resp.StatusCode != http.StatusFound || resp.HttpRedirectChain != "" {
+		t.Errorf("not following: StatusCode, HttpRedirectChain = %d, %q", resp.StatusCode, resp.HttpRedirectChain)
+	}
+
+	resp = Send(&fuzzTypes.SendMeta{Request: s.req("/redirect/2"), HttpFollowRedirects: true})
+	want := s.URL + "/redirect/2 -> " + s.URL + "/redirect/1 -> " + s.URL + "/redirect/0"
+	if resp.StatusCode != 200 || string(resp.RawResponse) != "landed" || resp.HttpRedirectChain != want {
+		t.Errorf("following: StatusCode, RawResponse, HttpRedirectChain = %d, %q, %q",
+			resp.StatusCode, resp.RawResponse, resp.HttpRedirectChain)
+	}
+
+	resp = Send(&fuzzTypes.SendMeta{Request: s.req("/echo"), HttpFollowRedirects: true})
+	if resp.HttpRedirectChain != "" {
+		t.Errorf("no redirect: HttpRedirectChain = %q", resp.HttpRedirectChain)
+	}
+}
+
+func TestRedirectCap(t *testing.T) {
+	s := newTestServer(t)
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/redirect/50"), HttpFollowRedirects: true})
+	if resp.ErrMsg != "" || resp.StatusCode != http.StatusFound {
+		t.Fatalf("StatusCode, ErrMsg = %d, %q, want the last redirect", resp.StatusCode, resp.ErrMsg)
+	}
+	if chain := strings.Split(resp.HttpRedirectChain, " -> "); len(chain) != maxRedirects ||
+		chain[len(chain)-1] != s.URL+"/redirect/41" {
+		t.Errorf("HttpRedirectChain = %q", resp.HttpRedirectChain)
+	}
+	if s.hitCount() != maxRedirects {
+		t.Errorf("server got %d requests, want %d", s.hitCount(), maxRedirects)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		meta      fuzzTypes.SendMeta
+		wantHits  int
+		wantCode  int
+		wantError bool
+	}{
+		{"no retry by default", "/flaky/2", fuzzTypes.SendMeta{RetryCode: "503"}, 1, 503, false},
+		{"code list", "/flaky/2", fuzzTypes.SendMeta{Retry: 5, RetryCode: "500, 503"}, 3, 200, false},
+		{"code range", "/flaky/2", fuzzTypes.SendMeta{Retry: 5, RetryCode: "429,500-599"}, 3, 200, false},
+		{"code not listed", "/flaky/2", fuzzTypes.SendMeta{Retry: 5, RetryCode: "429"}, 1, 503, false},
+		{"retries exhausted", "/flaky/5", fuzzTypes.SendMeta{Retry: 2, RetryCode: "503"}, 3, 503, false},
+		{"regex", "/flaky/1", fuzzTypes.SendMeta{Retry: 5, RetryRegex: "busy"}, 2, 200, false},
+		{"regex no match", "/flaky/1", fuzzTypes.SendMeta{Retry: 5, RetryRegex: "^ok$"}, 1, 503, false},
+		{"transport error", "/drop/2", fuzzTypes.SendMeta{Retry: 5}, 3, 200, false},
+		{"transport error exhausted", "/drop/5", fuzzTypes.SendMeta{Retry: 1}, 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			meta := tt.meta
+			meta.Request = s.req(tt.path)
+			resp := Send(&meta)
+			if s.hitCount() != tt.wantHits {
+				t.Errorf("server got %d requests, want %d", s.hitCount(), tt.wantHits)
+			}
+			if resp.StatusCode != tt.wantCode || (resp.ErrMsg != "") != tt.wantError {
+				t.Errorf("StatusCode, ErrMsg = %d, %q", resp.StatusCode, resp.ErrMsg)
+			}
+		})
+	}
+}
+
+func TestTruncatedBody(t *testing.T) {
+	s := newTestServer(t)
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/truncated")})
+	if !strings.Contains(resp.ErrMsg, "reading response body") || resp.Error != resp.ErrMsg {
+		t.Errorf("ErrMsg, Error = %q, %q", resp.ErrMsg, resp.Error)
+	}
+	if resp.StatusCode != 0 || resp.HttpResponse != nil || resp.RawResponse != nil || resp.Size != 0 {
+		t.Errorf("a failed read filled the response: %+v", resp)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := newTestServer(t)
+	start := time.Now()
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/slow"), Timeout: 1})
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("took %v with a 1s timeout", elapsed)
+	}
+	if !strings.Contains(resp.ErrMsg, "Timeout") {
+		t.Errorf("ErrMsg = %q, want a timeout", resp.ErrMsg)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+	for _, p := range []string{proxy.URL, strings.TrimPrefix(proxy.URL, "http://")} {
+		resp := Send(&fuzzTypes.SendMeta{Request: &fuzzTypes.Req{URL: "http://fuzzgiu.invalid/a"}, Proxy: p})
+		if string(resp.RawResponse) != "proxied http://fuzzgiu.invalid/a" {
+			t.Errorf("proxy %s: RawResponse, ErrMsg = %q, %q", p, resp.RawResponse, resp.ErrMsg)
+		}
+	}
+	if proxied != 2 {
+		t.Errorf("proxy got %d requests, want 2", proxied)
+	}
+	resp := Send(&fuzzTypes.SendMeta{Request: &fuzzTypes.Req{URL: "http://fuzzgiu.invalid/"}, Proxy: "ftp://127.0.0.1:21"})
+	if !strings.Contains(resp.ErrMsg, "unsupported proxy scheme") {
+		t.Errorf("ftp proxy: ErrMsg = %q", resp.ErrMsg)
+	}
+}
+
+func TestFillBody(t *testing.T) {
+	tests := []struct {
+		body               string
+		size, words, lines int
+	}{
+		{"", 0, 0, 0},
+		{"one", 3, 1, 1},
+		{"hello world\n", 12, 2, 2},
+		{"a b\nc\n\nd e f", 12, 6, 4},
+	}
+	for _, tt := range tests {
+		resp := new(fuzzTypes.Resp)
+		FillBody(resp, []byte(tt.body))
+		if resp.Size != tt.size || resp.Words != tt.words || resp.Lines != tt.lines {
+			t.Errorf("FillBody(%q) = size %d, words %d, lines %d, want %d, %d, %d",
+				tt.body, resp.Size, resp.Words, resp.Lines, tt.size, tt.words, tt.lines)
+		}
+	}
+	s := newTestServer(t)
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/empty")})
+	if resp.ErrMsg != "" || resp.Size != 0 || resp.Words != 0 || resp.Lines != 0 || len(resp.RawResponse) != 0 {
+		t.Errorf("empty body: %+v", resp)
+	}
+	resp = Send(&fuzzTypes.SendMeta{Request: s.req("/status/404")})
+	if resp.Size != 10 || resp.Words != 2 || resp.Lines != 1 {
+		t.Errorf("status/404: size %d, words %d, lines %d", resp.Size, resp.Words, resp.Lines)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	s := newTestServer(t)
+	prepared := int32(0)
+	defaults := make([]bool, 0)
+	sender := &Sender{
+		Prepare: func(r *http.Request, meta *fuzzTypes.SendMeta) error {
+			atomic.AddInt32(&prepared, 1)
+			r.Header.Set("X-Test", "signed")
+			return nil
+		},
+		// 200时也重试，503时不重试
+		Retry: func(resp *fuzzTypes.Resp, meta *fuzzTypes.SendMeta, retry bool) bool {
+			defaults = append(defaults, retry)
+			return resp.StatusCode == 200
+		},
+	}
+	resp := sender.Send(&fuzzTypes.SendMeta{Request: s.req("/echo"), Retry: 2})
+	if !strings.Contains(string(resp.RawResponse), "x=signed") {
+		t.Errorf("Prepare did not change the request: %q", resp.RawResponse)
+	}
+	if prepared != 3 || s.hitCount() != 3 {
+		t.Errorf("Prepare called %d times, server got %d requests, want 3 and 3", prepared, s.hitCount())
+	}
+	if len(defaults) != 2 || defaults[0] || defaults[1] {
+		t.Errorf("Retry called with %v, want [false false]", defaults)
+	}
+
+	s = newTestServer(t)
+	defaults = defaults[:0]
+	resp = sender.Send(&fuzzTypes.SendMeta{Request: s.req("/flaky/5"), Retry: 3, RetryCode: "503"})
+	if resp.StatusCode != 503 || s.hitCount() != 1 {
+		t.Errorf("StatusCode %d, server got %d requests, want 503 and 1", resp.StatusCode, s.hitCount())
+	}
+	if len(defaults) != 1 || !defaults[0] {
+		t.Errorf("Retry called with %v, want [true]", defaults)
+	}
+
+	custom := &Sender{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 299, Proto: "HTTP/1.1", Header: http.Header{},
+			Body: io.NopCloser(strings.NewReader("from transport")), Request: r}, nil
+	})}
+	resp = custom.Send(&fuzzTypes.SendMeta{Request: &fuzzTypes.Req{URL: "http://fuzzgiu.invalid/"}})
+	if resp.StatusCode != 299 || string(resp.RawResponse) != "from transport" {
+		t.Errorf("custom Transport: StatusCode, RawResponse = %d, %q", resp.StatusCode, resp.RawResponse)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestParseRetryCode(t *testing.T) {
+	ranges, err := parseRetryCode(" 429 , 500-599,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[int]bool{429: true, 500: true, 503: true, 599: true, 428: false, 600: false, 200: false} {
+		if ranges.contains(code) != want {
+			t.Errorf("contains(%d) = %v, want %v", code, !want, want)
+		}
+	}
+	if ranges, err = parseRetryCode(""); err != nil || len(ranges) != 0 {
+		t.Errorf("empty: %v, %v", ranges, err)
+	}
+	for _, bad := range []string{"5xx", "500-", "-500", "600-500", "500-5x9", "429;503"} {
+		if _, err := parseRetryCode(bad); err == nil {
+			t.Errorf("parseRetryCode(%q) accepted", bad)
+		}
+	}
+	s := newTestServer(t)
+	resp := Send(&fuzzTypes.SendMeta{Request: s.req("/echo"), RetryCode: "5xx"})
+	if !strings.Contains(resp.ErrMsg, "invalid retry_code") || s.hitCount() != 0 {
+		t.Errorf("ErrMsg = %q, server got %d requests", resp.ErrMsg, s.hitCount())
+	}
+	resp = Send(&fuzzTypes.SendMeta{Request: s.req("/echo"), RetryRegex: "("})
+	if !strings.Contains(resp.ErrMsg, "invalid retry_regex") {
+		t.Errorf("ErrMsg = %q", resp.ErrMsg)
+	}
+}
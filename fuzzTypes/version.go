@@ -0,0 +1,6 @@
+package fuzzTypes
+
+// SchemaVersion fuzzTypes中类型定义的版本（语义化版本），与FuzzGIU中的类型保持一致。
+// 构建器生成的插件以 require FuzzGIUPluginBuilder/fuzzTypes v<SchemaVersion> 引用本模块，构建时写入插件元数据。
+// 修改类型定义时同步修改：删除或修改字段、改变JSON tag提高主版本号，新增字段、常量或SDK包（如reactSDK、sendSDK）提高次版本号，只修改注释提高修订号
+const SchemaVersion = "1.3.0"
@@ -2,88 +2,469 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"log"
+	"go/format"
+	"io"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func getPluginFun(template string) string {
-	switch template {
-	case "payloadProc":
-		return "func PayloadProcessor(payload string, /* CUSTOM ARGUMENTS */) string {\n}"
-	case "reactor":
-		return "func React(request *fuzzTypes.Req, resp *fuzzTypes.Resp, /* CUSTOM ARGUMENTS */) *fuzzTypes.Reaction {\n}"
-	case "preprocess":
-		return "func Preprocessor(fuzz *fuzzTypes.Fuzz, /* CUSTOM ARGUMENTS */) *fuzzTypes.Fuzz {\n}"
-	case "payloadGen":
-		return "func PayloadGenerator(/* CUSTOM ARGUMENTS */) []string {\n}"
-	case "reqSender":
-		return "func ReqSender(sendMeta *fuzzTypes.SendMeta, /* CUSTOM ARGUMENTS */) *fuzzTypes.Resp {\n}"
-	}
-	return ""
+// genOptions builder -gen 的参数
+type genOptions struct {
+	Path          string // 生成的目录
+	TemplateType  string
+	PluginFunName string
+	Force         bool   // 覆盖已存在的文件
+	Update        bool   // 只更新fuzzTypes与go.mod中的Go版本，见genUpdate
+	Into          string // 将插件包生成到已有的模块（或go.work所在目录）中，此时Path为插件包目录，相对路径相对于Into，见intoLayout
 }
 
-func gen(genPath *string, templateType *string, pluginFunName string, goVer []byte) {
-	if *templateType == "" {
+// 生成的文件，Name为相对于genLayout.Root的路径（以/分隔）
+type genFile struct {
+	Name string
+	Data []byte
+}
+
+// 旧版本gen复制到插件项目中的fuzzTypes.go的位置，现在生成的插件引用fuzzTypes SDK
+const genFuzzTypesFile = "components/fuzzTypes/fuzzTypes.go"
+
+// gen 在opt.Path下生成插件开发环境：
+//
+//	go.mod             require fuzzTypes SDK，并以本地replace指向构建器中的SDK目录，不需要联网
+//	plugin.go          可以直接编译的示例插件
+//	plugin_test.go     用testdata下的用例直接测试插件函数
+//	testdata/*.json    builder test与go test共用的用例
+//	README.md          构建、测试与在FuzzGIU中使用插件的方法
+//	fuzzgiu.json       构建配置，其中写入了插件类型
+//
+// 使用-into时只生成插件包中的文件，go.mod与fuzzTypes见intoLayout。
+// 先在内存中生成全部文件，其中任何一个已经存在且没有-force时不写入任何文件
+func gen(opt *genOptions, toolchain *goToolchain) {
+	fail := func(err error) { // 生成失败多为目录无法写入或模板缺失，归为环境问题
+		fmt.Println(err)
+		os.Exit(exitEnvironment)
+	}
+	if opt.Update {
+		dir := opt.Path
+		if opt.Into != "" && !filepath.IsAbs(dir) {
+			dir = filepath.Join(opt.Into, dir)
+		}
+		if err := genUpdate(dir, toolchain, os.Stdout); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if opt.TemplateType == "" {
 		fmt.Println("No template provided to generate")
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
-	err := os.MkdirAll(*genPath, 0755)
-	if err != nil && !os.IsExist(err) {
-		fmt.Printf("Error creating dir: %s - %v\n", *genPath, err)
-		os.Exit(1)
+	scaffold := pluginScaffolds[opt.TemplateType]
+	if scaffold == nil {
+		fmt.Printf("Unsupported template type: %s\n", opt.TemplateType)
+		os.Exit(exitUsage)
 	}
-	err = os.MkdirAll(*genPath+"/components/fuzzTypes/", 0755)
+	layout := newModuleLayout(opt.Path, opt.PluginFunName)
+	if opt.Into != "" {
+		var err error
+		if layout, err = intoLayout(opt.Into, opt.Path, toolchain); err != nil {
+			fail(err)
+		}
+	}
+	if scaffold.SDK != nil && layout.FuzzTypesPath == fuzzTypesModule {
+		sdkScaffold := *scaffold
+		sdkScaffold.Imports, sdkScaffold.Function, sdkScaffold.Example = scaffold.SDK.Imports, scaffold.SDK.Function, scaffold.SDK.Example
+		scaffold = &sdkScaffold
+	}
+	tmpls := make(map[string][]byte)
+	for _, name := range []string{"plugin.gotmp", "pluginTest.gotmp", "pluginReadme.mdtmp"} {
+		tmpl, err := os.ReadFile(filepath.Join("templates", name))
+		if err != nil {
+			fail(err)
+		}
+		tmpls[name] = tmpl
+	}
+	sdk, err := sdkDir()
 	if err != nil {
-		fmt.Printf("Error creating dir: %s\n", *genPath)
+		fail(err)
 	}
-	// 复制fuzzTypes.go声明文件到components/fuzzTypes/目录下
-	err = copyFileToDir("./fuzzTypes/fuzzTypes.go", *genPath+"/components/fuzzTypes/")
+	version, err := schemaVersion(sdk)
+	if err != nil || version == "" {
+		fail(fmt.Errorf("cannot read SchemaVersion of the fuzzTypes SDK in %s: %v", sdk, err))
+	}
+	goLine, toolchainLine, err := toolchain.modDirectives()
 	if err != nil {
-		fmt.Printf("Failed to copy fuzzTypes.go to %s - %v\n", *genPath+"/components/fuzzTypes/", err)
+		fail(err)
+	}
+	files := make([]genFile, 0)
+	if layout.NewModule {
+		mod := "module " + layout.ModulePath + "\n\n" + goLine + "\n"
+		if toolchainLine != "" {
+			mod += toolchainLine + "\n"
+		}
+		if layout.RequireSDK {
+			mod += "\n" + sdkDirectives(version, sdk)
+		}
+		files = append(files, genFile{layout.file("go.mod"), []byte(mod)})
 	}
-	pGoTmp, err := os.ReadFile("templates/plugin.gotmp") // plugin.go模板文件
+	// 只在插件函数用到fuzzTypes时导入，否则无法编译
+	imports := append([]string(nil), scaffold.Imports...)
+	if strings.Contains(scaffold.Function, "fuzzTypes.") {
+		imports = append(imports, layout.FuzzTypesPath)
+	}
+	files = append(files, genFile{layout.file("plugin.go"), replacePlaceholders(tmpls["plugin.gotmp"], map[string]string{
+		"IMPORTS":         importBlock(imports),
+		"PLUGIN FUNCTION": scaffold.Function,
+	})}, genFile{layout.file("plugin_test.go"), replacePlaceholders(tmpls["pluginTest.gotmp"], map[string]string{
+		"FUZZTYPES PATH": layout.FuzzTypesPath,
+		"CALL PLUGIN":    scaffold.Call,
+	})})
+	names := make([]string, 0, len(scaffold.Fixtures))
+	for name := range scaffold.Fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, genFile{layout.file("testdata/" + name), []byte(scaffold.Fixtures[name] + "\n")})
+	}
+	output := (&buildOptions{TemplateType: opt.TemplateType}).outputName()
+	files = append(files, genFile{layout.file("README.md"), replacePlaceholders(tmpls["pluginReadme.mdtmp"], map[string]string{
+		"MODULE NAME":          layout.PackagePath,
+		"FUZZTYPES PATH":       layout.FuzzTypesPath,
+		"TEMPLATE TYPE":        opt.TemplateType,
+		"PLUGIN FUNCTION NAME": opt.PluginFunName,
+		"OUTPUT":               output,
+		"EXAMPLE":              scaffold.Example,
+		"FUZZGIU USAGE":        strings.Replace(scaffold.Usage, "{name}", strings.TrimSuffix(output, filepath.Ext(output)), -1),
+	})})
+	conf, err := json.MarshalIndent(map[string]string{"type": opt.TemplateType}, "", "  ")
 	if err != nil {
-		panic(err)
+		fail(err)
+	}
+	files = append(files, genFile{layout.file(buildConfigName), append(conf, '\n')})
+	if !opt.Force {
+		existing := make([]string, 0)
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(layout.Root, filepath.FromSlash(f.Name))); err == nil {
+				existing = append(existing, f.Name)
+			}
+		}
+		if len(existing) > 0 {
+			fmt.Printf("%s already has %s, not overwriting.\n"+
+				"use -force to overwrite them, or -update to only refresh fuzzTypes and the go version\n",
+				layout.Root, strings.Join(existing, ", "))
+			os.Exit(exitUsage)
+		}
+	}
+	for _, f := range files {
+		fmt.Printf("Creating %s...", f.Name)
+		if err = writeGenFile(layout.Root, f); err != nil {
+			fail(err)
+		}
+		fmt.Println("Done")
+	}
+	if layout.NewModule {
+		fmt.Printf("go.mod: %s\n", strings.TrimSpace(goLine+" "+toolchainLine))
+	}
+	if layout.GoWork != "" { // 将新模块加入工作区
+		fmt.Printf("Adding %s to %s...", layout.PluginDir, layout.GoWork)
+		use := exec.Command(toolchain.Path, "work", "use", "./"+layout.PluginDir)
+		use.Dir = filepath.Dir(layout.GoWork)
+		if output, err := use.CombinedOutput(); err != nil {
+			fail(goCommandError("go work use", err, output))
+		}
+		fmt.Println("Done")
+	}
+	switch {
+	case layout.RequireSDK && !layout.NewModule: // 已有的模块
+		fmt.Printf("Adding %s v%s to %s...", fuzzTypesModule, version, filepath.Join(layout.Root, "go.mod"))
+		if err = requireSDK(toolchain, layout.Root, version, sdk); err != nil {
+			fail(err)
+		}
+		fmt.Println("Done")
+	case layout.FuzzTypesPath != fuzzTypesModule:
+		fmt.Printf("Using the existing fuzzTypes package %s\n", layout.FuzzTypesPath)
+	}
+	if layout.FuzzTypesPath == fuzzTypesModule {
+		fmt.Printf("fuzzTypes: %s v%s => %s\n", fuzzTypesModule, version, sdk)
 	}
-	pluginFun := getPluginFun(*templateType)
-	err = os.Chdir(*genPath) // 进入生成的目录
+	absPath, err := filepath.Abs(filepath.Join(layout.Root, filepath.FromSlash(layout.PluginDir)))
 	if err != nil {
-		panic(err)
+		fail(err)
 	}
-	fmt.Print("Generating go.mod...")
-	goMod, err := os.Create("go.mod") // 创建go.mod文件
+	fmt.Printf("Done. Successfully created plugin project at %s\n", absPath)
+}
+
+// 将f写入dir下，Go文件先格式化，整理替换占位符后多出的空行
+func writeGenFile(dir string, f genFile) error {
+	data := f.Data
+	if filepath.Ext(f.Name) == ".go" {
+		formatted, err := format.Source(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		data = formatted
+	}
+	path := filepath.Join(dir, filepath.FromSlash(f.Name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error creating dir: %s - %v", filepath.Dir(path), err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// genUpdate 更新dir下由gen生成的插件：将插件所在模块require的fuzzTypes SDK更新为构建器中SDK的版本，
+// 旧版本复制到插件中的fuzzTypes.go则用构建器中的fuzzTypes.go替换，并列出类型的变化；
+// 将go.mod中的go指令提高到当前工具链的版本。不修改插件代码与其他文件
+func genUpdate(dir string, toolchain *goToolchain, out io.Writer) error {
+	env, err := goEnv(&buildOptions{GoPath: toolchain.Path}, dir, "GOMOD", "GOWORK")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer goMod.Close()
-	modName := pluginFunName + "FuzzGIU"
-	mod := "module " + modName + "\n"
-	version := "go " + string(goVer) + "\n"
-	_, err = goMod.Write([]byte(mod + version))
+	modPath := env["GOMOD"]
+	if modPath == "" || modPath == os.DevNull {
+		return fmt.Errorf("%s is not a plugin generated by builder -gen: it is not in a Go module", dir)
+	}
+	mod, err := os.ReadFile(modPath)
 	if err != nil {
-		fmt.Print("Failed to write to go.mod.")
-		os.Remove("go.mod")
-		panic(err)
+		return err
+	}
+	if requiresSDK(mod) {
+		err = updateSDK(modPath, toolchain, out)
+	} else {
+		err = updateFuzzTypesCopy(dir, modPath, env["GOWORK"], toolchain, out)
 	}
-	fmt.Printf("Done, go version %s\n", string(goVer))
-	fmt.Printf("Creating plugin.go...")
-	pluginGo, err := os.Create("plugin.go") // 创建plugin.go文件
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer pluginGo.Close()
-	// 替换模板数据
-	pGoTmp = bytes.Replace(pGoTmp, []byte("/* MODULE NAME */"), []byte(modName), -1)
-	pGoTmp = bytes.Replace(pGoTmp, []byte("/* PLUGIN FUNCTION */"), []byte(pluginFun), -1)
-	_, err = pluginGo.Write(pGoTmp)
+	if mod, err = os.ReadFile(modPath); err != nil {
+		return err
+	}
+	goLine, toolchainLine, err := toolchain.modDirectives()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	updated, oldGoLine := updateModDirectives(mod, goLine, toolchainLine)
+	if bytes.Equal(updated, mod) {
+		fmt.Fprintf(out, "%s: %s is up to date\n", modPath, oldGoLine)
+		return nil
+	}
+	if err = os.WriteFile(modPath, updated, 0644); err != nil {
+		return err
 	}
-	absPath, err := filepath.Abs(*genPath)
+	fmt.Fprintf(out, "%s: %s -> %s\n", modPath, oldGoLine, strings.TrimSpace(goLine+" "+toolchainLine))
+	return nil
+}
+
+// updateSDK 将go.mod中require的fuzzTypes SDK更新为构建器中SDK的版本，replace指向构建器中的SDK目录。
+// 原来的replace指向其他目录时列出两者类型的变化
+func updateSDK(modPath string, toolchain *goToolchain, out io.Writer) error {
+	edit := exec.Command(toolchain.Path, "mod", "edit", "-json", modPath)
+	output, err := edit.CombinedOutput()
 	if err != nil {
-		panic(err)
+		return goCommandError("go mod edit", err, output)
 	}
-	fmt.Printf("Done. Successfully created plugin project at %s\n", absPath)
+	modFile := new(struct {
+		Require []struct {
+			Path    string
+			Version string
+		}
+		Replace []struct {
+			Old struct{ Path string }
+			New struct{ Path string }
+		}
+	})
+	if err = json.Unmarshal(output, modFile); err != nil {
+		return fmt.Errorf("go mod edit failed: %v", err)
+	}
+	oldVersion, oldDir := "", ""
+	for _, r := range modFile.Require {
+		if r.Path == fuzzTypesModule {
+			oldVersion = r.Version
+		}
+	}
+	for _, r := range modFile.Replace {
+		if r.Old.Path == fuzzTypesModule {
+			oldDir = r.New.Path
+			if !filepath.IsAbs(oldDir) {
+				oldDir = filepath.Join(filepath.Dir(modPath), oldDir)
+			}
+		}
+	}
+	sdk, err := sdkDir()
+	if err != nil {
+		return err
+	}
+	version, err := schemaVersion(sdk)
+	if err != nil || version == "" {
+		return fmt.Errorf("cannot read SchemaVersion of the fuzzTypes SDK in %s: %v", sdk, err)
+	}
+	if oldVersion == "v"+version && filepath.Clean(oldDir) == sdk {
+		fmt.Fprintf(out, "%s %s is up to date\n", fuzzTypesModule, oldVersion)
+		return nil
+	}
+	if oldDir != "" && filepath.Clean(oldDir) != sdk {
+		if oldTypes, err := os.ReadFile(filepath.Join(oldDir, "fuzzTypes.go")); err == nil {
+			newTypes, err := os.ReadFile(filepath.Join(sdk, "fuzzTypes.go"))
+			if err != nil {
+				return err
+			}
+			changes, err := typesDiff(oldTypes, newTypes)
+			if err != nil {
+				return fmt.Errorf("%s: %v", oldDir, err)
+			}
+			for _, change := range changes {
+				fmt.Fprintln(out, "  "+change)
+			}
+		}
+	}
+	if err = requireSDK(toolchain, filepath.Dir(modPath), version, sdk); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %s %s -> v%s => %s\n", modPath, fuzzTypesModule, oldVersion, version, sdk)
+	return nil
+}
+
+// updateFuzzTypesCopy 用构建器中的fuzzTypes.go替换旧版本gen复制到插件中的副本并列出类型的变化。
+// fuzzTypes.go先在dir下的components/fuzzTypes中查找，再在插件所在的模块与go.work中的其他模块中查找
+func updateFuzzTypesCopy(dir, modPath, goWork string, toolchain *goToolchain, out io.Writer) error {
+	typesPath := filepath.Join(dir, filepath.FromSlash(genFuzzTypesFile))
+	if _, err := os.Stat(typesPath); err != nil {
+		modules := []string{filepath.Dir(modPath)}
+		if goWork != "" && goWork != "off" {
+			workModules, err := workspaceModules(toolchain, goWork)
+			if err != nil {
+				return err
+			}
+			modules = append(modules, workModules...)
+		}
+		typesPath = ""
+		for _, root := range modules {
+			if fuzzTypesDir := findFuzzTypes(root); fuzzTypesDir != "" {
+				typesPath = filepath.Join(fuzzTypesDir, "fuzzTypes.go")
+				break
+			}
+		}
+		if typesPath == "" {
+			return fmt.Errorf("no fuzzTypes package found for %s", dir)
+		}
+	}
+	oldTypes, err := os.ReadFile(typesPath)
+	if err != nil {
+		return err
+	}
+	newTypes, err := os.ReadFile("fuzzTypes/fuzzTypes.go")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(oldTypes, newTypes) {
+		fmt.Fprintf(out, "%s is up to date\n", typesPath)
+		return nil
+	}
+	changes, err := typesDiff(oldTypes, newTypes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", typesPath, err)
+	}
+	if err = os.WriteFile(typesPath, newTypes, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Updated %s\n", typesPath)
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "  only comments or formatting changed")
+	}
+	for _, change := range changes {
+		fmt.Fprintln(out, "  "+change)
+	}
+	return nil
+}
+
+// 模块的go指令中的版本，如 go 1.22.3 返回 [1 22 3]
+var modGoLineRe = regexp.MustCompile(`^go (\d+)\.(\d+)(?:\.(\d+))?`)
+
+func modGoVersion(line string) [3]int {
+	var v [3]int
+	if m := modGoLineRe.FindStringSubmatch(line); m != nil {
+		for i := range v {
+			v[i], _ = strconv.Atoi(m[i+1])
+		}
+	}
+	return v
+}
+
+// updateModDirectives 在go.mod中的go指令低于goLine时将其提高到goLine，并写入toolchainLine（为空时保留原有的toolchain指令）。
+// go指令已经不低于goLine时不做修改，不会降低模块要求的版本。返回更新后的内容与原来的go指令
+func updateModDirectives(mod []byte, goLine, toolchainLine string) ([]byte, string) {
+	lines := strings.Split(string(mod), "\n")
+	goIndex, toolchainIndex, moduleIndex := -1, -1, -1
+	for i, line := range lines {
+		switch fields := strings.Fields(line); {
+		case len(fields) == 0:
+		case fields[0] == "module" && moduleIndex < 0:
+			moduleIndex = i
+		case fields[0] == "go":
+			goIndex = i
+		case fields[0] == "toolchain":
+			toolchainIndex = i
+		}
+	}
+	oldGoLine := "no go directive"
+	if goIndex >= 0 {
+		oldGoLine = strings.TrimSpace(lines[goIndex])
+		old, cur := modGoVersion(oldGoLine), modGoVersion(goLine)
+		if old[0] > cur[0] || (old[0] == cur[0] && (old[1] > cur[1] || (old[1] == cur[1] && old[2] >= cur[2]))) {
+			return mod, oldGoLine
+		}
+		lines[goIndex] = goLine
+	} else { // 没有go指令时写在module指令之后
+		goIndex = moduleIndex + 1
+		lines = append(lines[:goIndex], append([]string{"", goLine}, lines[goIndex:]...)...)
+		goIndex++
+		if toolchainIndex >= 0 {
+			toolchainIndex += 2
+		}
+	}
+	switch {
+	case toolchainLine == "":
+	case toolchainIndex >= 0:
+		lines[toolchainIndex] = toolchainLine
+	default:
+		lines = append(lines[:goIndex+1], append([]string{toolchainLine}, lines[goIndex+1:]...)...)
+	}
+	return []byte(strings.Join(lines, "\n")), oldGoLine
+}
+
+// 将模板中的 /* NAME */ 替换为values中对应的值
+func replacePlaceholders(tmpl []byte, values map[string]string) []byte {
+	for name, value := range values {
+		tmpl = bytes.Replace(tmpl, []byte("/* "+name+" */"), []byte(value), -1)
+	}
+	return tmpl
+}
+
+// 生成import语句，标准库在前，其他包在后并以空行分隔
+func importBlock(imports []string) string {
+	if len(imports) == 0 {
+		return ""
+	}
+	std, others := make([]string, 0), make([]string, 0)
+	for _, imp := range imports {
+		if strings.Contains(strings.SplitN(imp, "/", 2)[0], ".") || path.Base(imp) == "fuzzTypes" ||
+			strings.HasPrefix(imp, fuzzTypesModule+"/") {
+			others = append(others, "\t\""+imp+"\"")
+		} else {
+			std = append(std, "\t\""+imp+"\"")
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	lines := std
+	if len(std) > 0 && len(others) > 0 {
+		lines = append(lines, "")
+	}
+	return "import (\n" + strings.Join(append(lines, others...), "\n") + "\n)"
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// genLayout gen生成的文件的布局。单独生成时插件目录即为新模块；-into时插件包加入已有的模块，
+// 多个插件共用fuzzTypes SDK，或模块（或go.work中其他模块）中已有的fuzzTypes包
+type genLayout struct {
+	Root          string // 生成的文件相对于此目录
+	PluginDir     string // 插件包目录，相对于Root，以/分隔，为空时即Root
+	ModulePath    string // 插件包所在模块的模块路径
+	PackagePath   string // 插件包的导入路径
+	NewModule     bool   // 是否为插件包生成go.mod
+	FuzzTypesPath string // fuzzTypes包的导入路径
+	RequireSDK    bool   // 是否需要在插件所在模块的go.mod中require fuzzTypes SDK
+	GoWork        string // 新模块需要加入的go.work，为空时不修改go.work
+}
+
+// 插件目录下的文件相对于Root的路径
+func (l *genLayout) file(name string) string {
+	return path.Join(l.PluginDir, name)
+}
+
+// 单独生成时的布局：插件目录为新模块，引用fuzzTypes SDK
+func newModuleLayout(dir, pluginFunName string) *genLayout {
+	modName := pluginFunName + "FuzzGIU"
+	return &genLayout{Root: dir, ModulePath: modName, PackagePath: modName, NewModule: true,
+		FuzzTypesPath: fuzzTypesModule, RequireSDK: true}
+}
+
+// intoLayout 计算-into时的布局。into为已有模块中的目录时，插件包位于into下的pluginDir（相对路径）中，
+// 导入路径由模块路径计算；into为go.work所在目录（不在任何模块中）时，插件目录为新模块并加入go.work。
+// 依次检查插件所在模块与go.work中的其他模块：已经require了fuzzTypes SDK时使用SDK，
+// 有旧版本复制的fuzzTypes包时复用该包；都没有时插件所在模块require SDK
+func intoLayout(into, pluginDir string, toolchain *goToolchain) (*genLayout, error) {
+	into, err := filepath.Abs(into)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(pluginDir) {
+		pluginDir = filepath.Join(into, pluginDir)
+	}
+	env, err := goEnv(&buildOptions{GoPath: toolchain.Path}, into, "GOMOD", "GOWORK")
+	if err != nil {
+		return nil, err
+	}
+	goWork := env["GOWORK"]
+	if goWork == "off" {
+		goWork = ""
+	}
+	layout := new(genLayout)
+	switch gomod := env["GOMOD"]; {
+	case gomod == "":
+		return nil, fmt.Errorf("module mode is disabled (GO111MODULE=off), plugins must be built in module mode")
+	case gomod != os.DevNull:
+		layout.Root = filepath.Dir(gomod)
+		if layout.ModulePath, err = modulePath(gomod); err != nil {
+			return nil, err
+		}
+	case goWork != "": // 工作区中的新模块，模块路径为插件目录相对于go.work的路径
+		layout.Root = filepath.Dir(goWork)
+		layout.NewModule, layout.GoWork = true, goWork
+	default:
+		return nil, fmt.Errorf("%s is not in a Go module or workspace: no go.mod or go.work in it or any parent directory", into)
+	}
+	if !isSubPath(layout.Root, pluginDir) || pluginDir == layout.Root && layout.NewModule {
+		return nil, fmt.Errorf("plugin directory %s must be inside %s", pluginDir, layout.Root)
+	}
+	rel, err := filepath.Rel(layout.Root, pluginDir)
+	if err != nil {
+		return nil, err
+	}
+	if layout.PluginDir = filepath.ToSlash(rel); layout.PluginDir == "." {
+		layout.PluginDir = ""
+	}
+	if layout.NewModule {
+		layout.ModulePath = layout.PluginDir
+		layout.PackagePath = layout.ModulePath
+	} else {
+		layout.PackagePath = path.Join(layout.ModulePath, layout.PluginDir)
+	}
+	// 查找已有的fuzzTypes，插件所在模块优先
+	modules := make([]string, 0)
+	if !layout.NewModule {
+		modules = append(modules, layout.Root)
+	}
+	if goWork != "" {
+		workModules, err := workspaceModules(toolchain, goWork)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range workModules {
+			if layout.NewModule || dir != layout.Root {
+				modules = append(modules, dir)
+			}
+		}
+	}
+	layout.FuzzTypesPath, layout.RequireSDK = fuzzTypesModule, true
+	for _, dir := range modules {
+		mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		if requiresSDK(mod) { // 新模块仍需要自己的require
+			layout.RequireSDK = layout.NewModule
+			return layout, nil
+		}
+		fuzzTypesDir := findFuzzTypes(dir)
+		if fuzzTypesDir == "" {
+			continue
+		}
+		modPath, err := modulePath(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(dir, fuzzTypesDir)
+		if err != nil {
+			return nil, err
+		}
+		layout.FuzzTypesPath, layout.RequireSDK = path.Join(modPath, filepath.ToSlash(rel)), false
+		return layout, nil
+	}
+	return layout, nil
+}
+
+// go.mod中的module指令
+var moduleDirectiveRe = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// 读取go.mod中的模块路径
+func modulePath(gomod string) (string, error) {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", err
+	}
+	m := moduleDirectiveRe.FindSubmatch(data)
+	if m == nil {
+		return "", fmt.Errorf("%s: no module directive", gomod)
+	}
+	return string(m[1]), nil
+}
+
+// go.work中use的模块目录
+func workspaceModules(toolchain *goToolchain, goWork string) ([]string, error) {
+	cmd := exec.Command(toolchain.Path, "work", "edit", "-json", goWork)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, goCommandError("go work edit", err, output)
+	}
+	work := new(struct {
+		Use []struct {
+			DiskPath string
+		}
+	})
+	if err = json.Unmarshal(output, work); err != nil {
+		return nil, fmt.Errorf("go work edit failed: %v", err)
+	}
+	dirs := make([]string, 0, len(work.Use))
+	for _, use := range work.Use {
+		dir := use.DiskPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(goWork), dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs, nil
+}
+
+// findFuzzTypes 在模块root中查找fuzzTypes包（包含package fuzzTypes的fuzzTypes.go的目录），
+// 不进入嵌套的模块、vendor、testdata与隐藏目录。有多个时返回层级最浅的，没有时返回空串
+func findFuzzTypes(root string) string {
+	found := ""
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if p != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, "fuzzgiuharness")) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name != "fuzzTypes.go" {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.PackageClauseOnly)
+		if err != nil || file.Name.Name != "fuzzTypes" {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		if found == "" || strings.Count(dir, string(filepath.Separator)) < strings.Count(found, string(filepath.Separator)) {
+			found = dir
+		}
+		return nil
+	})
+	return found
+}
@@ -1 +1,5 @@
 module FuzzGIUPluginBuilder
+
+require FuzzGIUPluginBuilder/fuzzTypes v1.3.0
+
+replace FuzzGIUPluginBuilder/fuzzTypes => ./fuzzTypes
@@ -0,0 +1,81 @@
+// Code generated by "builder abi" from templates/abi.json. DO NOT EDIT.
+
+package host
+
+import "FuzzGIUPluginBuilder/fuzzTypes"
+
+// AbiVersion 调用约定的版本
+const AbiVersion = 1
+
+// 插件导出的符号
+const (
+	SymbolWrapper      = "PluginWrapper"
+	SymbolNewInstance  = "NewInstance"
+	SymbolCall         = "Call"
+	SymbolFreeInstance = "FreeInstance"
+	SymbolMetadata     = "PluginMetadata"
+)
+
+// PayloadProc 调用payloadProc插件，对应插件函数PayloadProcessor，args为自定义参数
+func (c *Caller) PayloadProc(payload string, args ...interface{}) (string, error) {
+	var fixed []callArg
+	var err error
+	fixed = append(fixed, stringArg(payload))
+	result := ""
+	err = c.call(fixed, args, func(ret uintptr) error {
+		result = readGoString(ret)
+		return nil
+	})
+	return result, err
+}
+
+// React 调用reactor插件，对应插件函数React，args为自定义参数
+func (c *Caller) React(request *fuzzTypes.Req, resp *fuzzTypes.Resp, args ...interface{}) (*fuzzTypes.Reaction, error) {
+	var fixed []callArg
+	var err error
+	if fixed, err = appendJsonArgs(fixed, request); err != nil {
+		return nil, err
+	}
+	if fixed, err = appendJsonArgs(fixed, resp); err != nil {
+		return nil, err
+	}
+	result := new(fuzzTypes.Reaction)
+	err = c.call(fixed, args, decodeJson(result))
+	return result, err
+}
+
+// PayloadGen 调用payloadGen插件，对应插件函数PayloadGenerator，args为自定义参数
+func (c *Caller) PayloadGen(args ...interface{}) ([]string, error) {
+	var fixed []callArg
+	var err error
+	var result []string
+	err = c.call(fixed, args, func(ret uintptr) error {
+		result = readStringList(ret)
+		return nil
+	})
+	return result, err
+}
+
+// Preprocess 调用preprocess插件，对应插件函数Preprocessor，args为自定义参数
+func (c *Caller) Preprocess(fuzz *fuzzTypes.Fuzz, args ...interface{}) (*fuzzTypes.Fuzz, error) {
+	var fixed []callArg
+	var err error
+	if fixed, err = appendJsonArgs(fixed, fuzz); err != nil {
+		return nil, err
+	}
+	result := new(fuzzTypes.Fuzz)
+	err = c.call(fixed, args, decodeJson(result))
+	return result, err
+}
+
+// ReqSend 调用reqSender插件，对应插件函数ReqSender，args为自定义参数
+func (c *Caller) ReqSend(sendMeta *fuzzTypes.SendMeta, args ...interface{}) (*fuzzTypes.Resp, error) {
+	var fixed []callArg
+	var err error
+	if fixed, err = appendJsonArgs(fixed, sendMeta); err != nil {
+		return nil, err
+	}
+	result := new(fuzzTypes.Resp)
+	err = c.call(fixed, args, decodeJson(result))
+	return result, err
+}
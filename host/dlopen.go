@@ -0,0 +1,158 @@
+//go:build cgo && (linux || darwin) && (amd64 || arm64)
+// +build cgo
+// +build linux darwin
+// +build amd64 arm64
+
+package host
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+// 按平台调用约定，前NREGS个整数参数通过寄存器传递，其余参数依次压栈
+// arm64上两个字的参数无法全部放入寄存器时，剩余寄存器作废，后续参数也都压栈
+#if defined(__x86_64__)
+#define SPILL_EXHAUSTS 0
+#define NREGS 6
+#define REG_TYPES W, W, W, W, W, W
+#define REG_ARGS r[0], r[1], r[2], r[3], r[4], r[5]
+#else
+#define SPILL_EXHAUSTS 1
+#define NREGS 8
+#define REG_TYPES W, W, W, W, W, W, W, W
+#define REG_ARGS r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]
+#endif
+
+typedef uintptr_t W;
+
+static int fuzzgiu_nregs() { return NREGS; }
+static int fuzzgiu_spill_exhausts() { return SPILL_EXHAUSTS; }
+
+// 以寄存器参数r和栈参数s调用fn，栈参数最多16个
+static W fuzzgiu_call(void *fn, W *r, W *s, int ns) {
+	switch (ns) {
+	case 0: return ((W (*)(REG_TYPES))fn)(REG_ARGS);
+	case 1: return ((W (*)(REG_TYPES, W))fn)(REG_ARGS, s[0]);
+	case 2: return ((W (*)(REG_TYPES, W, W))fn)(REG_ARGS, s[0], s[1]);
+	case 3: return ((W (*)(REG_TYPES, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2]);
+	case 4: return ((W (*)(REG_TYPES, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3]);
+	case 5: return ((W (*)(REG_TYPES, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4]);
+	case 6: return ((W (*)(REG_TYPES, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5]);
+	case 7: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6]);
+	case 8: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7]);
+	case 9: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8]);
+	case 10: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9]);
+	case 11: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10]);
+	case 12: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11]);
+	case 13: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12]);
+	case 14: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12], s[13]);
+	case 15: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12], s[13], s[14]);
+	case 16: return ((W (*)(REG_TYPES, W, W, W, W, W, W, W, W, W, W, W, W, W, W, W, W))fn)(REG_ARGS, s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12], s[13], s[14], s[15]);
+	}
+	return 0;
+}
+
+static void *fuzzgiu_ptr(W p) { return (void *)p; }
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+const maxStackWords = 16
+
+// 已打开的动态库
+type library struct {
+	handle unsafe.Pointer
+}
+
+func openLibrary(path string) (*library, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	handle := C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("dlopen %s: %s", path, C.GoString(C.dlerror()))
+	}
+	return &library{handle: handle}, nil
+}
+
+func (lib *library) symbol(name string) (uintptr, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	sym := C.dlsym(lib.handle, cName)
+	if sym == nil {
+		return 0, fmt.Errorf("symbol %s not found", name)
+	}
+	return uintptr(sym), nil
+}
+
+func (lib *library) close() error {
+	if C.dlclose(lib.handle) != 0 {
+		return errors.New(C.GoString(C.dlerror()))
+	}
+	return nil
+}
+
+// 将参数展开为机器字并按调用约定分配到寄存器与栈上，然后调用sym。
+// 两个字的参数（GoString）只在剩余寄存器足够时通过寄存器传递，否则整体压栈；
+// arm64上一旦有参数压栈，后续参数也都压栈，amd64上后续的单字参数仍可使用剩余寄存器。
+// 参数数据被拷贝到C内存中，插件可能在返回值或实例中引用这些数据，因此由调用方在用完后调用release释放
+func invoke(sym uintptr, args []callArg) (ret uintptr, release func(), err error) {
+	nRegs := int(C.fuzzgiu_nregs())
+	spillExhausts := C.fuzzgiu_spill_exhausts() != 0
+	regs := make([]C.W, 8)
+	var stack []C.W
+	usedRegs := 0
+	var allocs []unsafe.Pointer
+	release = func() {
+		for _, p := range allocs {
+			C.free(p)
+		}
+		allocs = nil
+	}
+	for _, arg := range args {
+		var words []C.W
+		switch arg.kind {
+		case argWord:
+			words = []C.W{C.W(arg.word)}
+		case argPointer, argString:
+			p := C.CBytes(arg.data) // 拷贝到C内存，避免向插件传递Go指针
+			allocs = append(allocs, p)
+			words = []C.W{C.W(uintptr(p))}
+			if arg.kind == argString {
+				words = append(words, C.W(len(arg.data)))
+			}
+		}
+		if usedRegs+len(words) <= nRegs {
+			copy(regs[usedRegs:], words)
+			usedRegs += len(words)
+			continue
+		}
+		if spillExhausts {
+			usedRegs = nRegs
+		}
+		stack = append(stack, words...)
+	}
+	if len(stack) > maxStackWords {
+		release()
+		return 0, nil, fmt.Errorf("too many arguments, at most %d words can be passed on stack", maxStackWords)
+	}
+	stackPtr := (*C.W)(nil)
+	if len(stack) > 0 {
+		stackPtr = &stack[0]
+	}
+	// regs与stack中只有整数与C内存的地址，可以直接传给C
+	ret = uintptr(C.fuzzgiu_call(C.fuzzgiu_ptr(C.W(sym)), &regs[0], stackPtr, C.int(len(stack))))
+	return ret, release, nil
+}
+
+// 读取插件返回的内存，返回其拷贝
+func readMemory(p uintptr, n int) []byte {
+	return C.GoBytes(C.fuzzgiu_ptr(C.W(p)), C.int(n))
+}
@@ -0,0 +1,30 @@
+//go:build !cgo || !(linux || darwin) || !(amd64 || arm64)
+// +build !cgo !linux,!darwin !amd64,!arm64
+
+package host
+
+import "errors"
+
+var errUnsupported = errors.New("host: loading plugins requires cgo on linux or darwin (amd64/arm64)")
+
+type library struct{}
+
+func openLibrary(string) (*library, error) {
+	return nil, errUnsupported
+}
+
+func (lib *library) symbol(string) (uintptr, error) {
+	return 0, errUnsupported
+}
+
+func (lib *library) close() error {
+	return errUnsupported
+}
+
+func invoke(uintptr, []callArg) (uintptr, func(), error) {
+	return 0, nil, errUnsupported
+}
+
+func readMemory(uintptr, int) []byte {
+	return nil
+}
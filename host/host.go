@@ -0,0 +1,351 @@
+// Package host 是FuzzGIU插件的参考宿主实现：以dlopen加载构建出的动态库，按照包装模板约定的方式传参、
+// 解码返回的缓冲区，用于在不启动FuzzGIU的情况下检查插件的ABI（长度前缀、返回值编码、参数布局等）
+package host
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Param 插件自定义参数
+type Param struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Metadata 插件通过PluginMetadata导出的元数据
+type Metadata struct {
+	Version     int          `json:"fuzzgiu_plugin"`
+	Type        string       `json:"type"`     // 模板类型，如reactor
+	Function    string       `json:"function"` // 插件函数名，如React
+	Params      []Param      `json:"params"`   // 调用时需要传入的自定义参数
+	Instance    bool         `json:"instance"` // 是否为实例模式
+	CtorParams  []Param      `json:"ctor_params,omitempty"`
+	Concurrency int          `json:"concurrency"`          // 同时进入插件函数的最大调用数，0表示不限制
+	Repro       *ReproInputs `json:"repro,omitempty"`      // 可复现构建的输入摘要，仅-repro构建时存在
+	FuzzTypes   string       `json:"fuzz_types,omitempty"` // 插件引用的fuzzTypes SDK的SchemaVersion，未引用或引用旧版本的副本时为空
+}
+
+// ReproInputs 可复现构建（builder build -repro）的输入摘要，builder verify-repro据此重新构建并找出不同的输入。
+// 摘要只包含相对路径与内容，与源码所在位置无关；除版本与目标平台外均为sha256的前16位
+type ReproInputs struct {
+	GoVersion string       `json:"go_version"`
+	CC        string       `json:"cc"`     // C编译器版本，即 $CC --version 的第一行
+	Target    string       `json:"target"` // goos/goarch
+	GoEnv     string       `json:"go_env"` // 影响编译结果的go env，如GOAMD64、CGO_CFLAGS
+	Options   ReproOptions `json:"options"`
+	Template  string       `json:"template"`   // 包装模板
+	Plugin    string       `json:"plugin"`     // 插件文件与所在模块中的其他包（不包括fuzzTypes）
+	FuzzTypes string       `json:"fuzz_types"` // fuzzTypes包
+	Deps      string       `json:"deps"`       // 其他模块的版本与源文件
+	Modules   string       `json:"modules"`    // go.mod与go.sum
+}
+
+// ReproOptions 重新构建时需要沿用的构建参数，-trimpath等由可复现构建固定
+type ReproOptions struct {
+	Tags    string   `json:"tags,omitempty"`
+	Strip   bool     `json:"strip"`
+	Ldflags string   `json:"ldflags,omitempty"`
+	Gcflags string   `json:"gcflags,omitempty"`
+	Race    bool     `json:"race,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Mod     string   `json:"mod,omitempty"` // 如vendor，重新构建时以同样的方式解析依赖
+}
+
+// Plugin 已加载的插件动态库
+type Plugin struct {
+	Path string
+	Meta *Metadata // 插件没有导出PluginMetadata时为nil
+	lib  *library
+}
+
+// Caller 按插件类型调用插件。函数模式下由Plugin.Func获取，实例模式下由Plugin.NewInstance获取
+type Caller struct {
+	plugin   *Plugin
+	sym      uintptr
+	handle   uintptr
+	instance bool
+	release  func() // 释放构造函数参数占用的内存，实例可能一直引用这些参数
+}
+
+const (
+	argWord    = iota // 单个机器字：整数、bool、句柄、长度
+	argPointer        // 指向数据的指针
+	argString         // GoString，指针与长度两个字
+)
+
+// 调用时传入的单个参数
+type callArg struct {
+	kind int
+	word uintptr
+	data []byte
+}
+
+func wordArg(w uintptr) callArg {
+	return callArg{kind: argWord, word: w}
+}
+
+func stringArg(s string) callArg {
+	return callArg{kind: argString, data: []byte(s)}
+}
+
+// 将v编码为JSON，追加包装函数中对应的 (json *byte, jsonLen int) 两个参数
+func appendJsonArgs(args []callArg, v interface{}) ([]callArg, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, callArg{kind: argPointer, data: data}, wordArg(uintptr(len(data)))), nil
+}
+
+// Open 加载插件动态库，并读取其元数据
+func Open(path string) (*Plugin, error) {
+	lib, err := openLibrary(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{Path: path, lib: lib}
+	if sym, err := lib.symbol(SymbolMetadata); err == nil {
+		ret, _, err := invoke(sym, nil)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := readLenPrefixed(ret)
+		if err != nil {
+			return nil, fmt.Errorf("PluginMetadata: %v", err)
+		}
+		p.Meta = new(Metadata)
+		if err = json.Unmarshal(raw, p.Meta); err != nil {
+			return nil, fmt.Errorf("PluginMetadata: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// Close 卸载动态库。注意Go编写的动态库通常无法真正卸载
+func (p *Plugin) Close() error {
+	return p.lib.close()
+}
+
+// Func 获取函数模式插件的调用器
+func (p *Plugin) Func() (*Caller, error) {
+	sym, err := p.lib.symbol(SymbolWrapper)
+	if err != nil {
+		return nil, err
+	}
+	return &Caller{plugin: p, sym: sym}, nil
+}
+
+// NewInstance 调用实例模式插件的NewInstance创建实例，args为构造函数参数
+func (p *Plugin) NewInstance(args ...interface{}) (*Caller, error) {
+	newInstance, err := p.lib.symbol(SymbolNewInstance)
+	if err != nil {
+		return nil, err
+	}
+	call, err := p.lib.symbol(SymbolCall)
+	if err != nil {
+		return nil, err
+	}
+	callArgs, err := toCallArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	handle, release, err := invoke(newInstance, callArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &Caller{plugin: p, sym: call, handle: handle, instance: true, release: release}, nil
+}
+
+// Free 释放实例，函数模式下什么也不做
+func (c *Caller) Free() error {
+	if !c.instance {
+		return nil
+	}
+	free, err := c.plugin.lib.symbol(SymbolFreeInstance)
+	if err != nil {
+		return err
+	}
+	_, _, err = invoke(free, []callArg{wordArg(c.handle)})
+	c.release()
+	return err
+}
+
+// 调用插件：实例模式下第一个参数为句柄，之后是固定参数与自定义参数。decode在释放参数内存之前解码返回值
+func (c *Caller) call(fixed []callArg, args []interface{}, decode func(ret uintptr) error) error {
+	custom, err := toCallArgs(args)
+	if err != nil {
+		return err
+	}
+	var callArgs []callArg
+	if c.instance {
+		callArgs = append(callArgs, wordArg(c.handle))
+	}
+	callArgs = append(append(callArgs, fixed...), custom...)
+	ret, release, err := invoke(c.sym, callArgs)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if ret == 0 {
+		return errors.New("plugin returned a null pointer")
+	}
+	return decode(ret)
+}
+
+// 解码长度前缀JSON的返回值到result
+func decodeJson(result interface{}) func(ret uintptr) error {
+	return func(ret uintptr) error {
+		raw, err := readLenPrefixed(ret)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, result)
+	}
+}
+
+// 将自定义参数转换为调用参数，浮点数通过浮点寄存器传递，不支持
+func toCallArgs(args []interface{}) ([]callArg, error) {
+	callArgs := make([]callArg, 0, len(args))
+	for i, arg := range args {
+		var w uintptr
+		switch v := arg.(type) {
+		case string:
+			callArgs = append(callArgs, stringArg(v))
+			continue
+		case bool:
+			if v {
+				w = 1
+			}
+		case int:
+			w = uintptr(v)
+		case int8:
+			w = uintptr(v)
+		case int16:
+			w = uintptr(v)
+		case int32:
+			w = uintptr(v)
+		case int64:
+			w = uintptr(v)
+		case uint:
+			w = uintptr(v)
+		case uint8:
+			w = uintptr(v)
+		case uint16:
+			w = uintptr(v)
+		case uint32:
+			w = uintptr(v)
+		case uint64:
+			w = uintptr(v)
+		case uintptr:
+			w = v
+		default:
+			return nil, fmt.Errorf("argument #%d: unsupported type %T", i, arg)
+		}
+		callArgs = append(callArgs, wordArg(w))
+	}
+	return callArgs, nil
+}
+
+// ConvertArgs 按参数列表中声明的类型解码JSON参数。params为空（插件没有元数据）时根据JSON值推断类型
+func ConvertArgs(params []Param, raw []json.RawMessage) ([]interface{}, error) {
+	if len(params) > 0 && len(params) != len(raw) {
+		return nil, fmt.Errorf("plugin expects %d arguments (%s), got %d",
+			len(params), describeParams(params), len(raw))
+	}
+	args := make([]interface{}, len(raw))
+	for i, r := range raw {
+		typ := ""
+		if len(params) > 0 {
+			typ = params[i].Type
+		} else {
+			var v interface{}
+			if err := json.Unmarshal(r, &v); err != nil {
+				return nil, fmt.Errorf("argument #%d: %v", i, err)
+			}
+			switch v.(type) {
+			case string:
+				typ = "string"
+			case bool:
+				typ = "bool"
+			case float64:
+				typ = "int"
+			}
+		}
+		var err error
+		switch typ {
+		case "string":
+			var s string
+			err = json.Unmarshal(r, &s)
+			args[i] = s
+		case "bool":
+			var b bool
+			err = json.Unmarshal(r, &b)
+			args[i] = b
+		case "int", "int8", "int16", "int32", "int64":
+			var n int64
+			err = json.Unmarshal(r, &n)
+			args[i] = n
+		case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+			var n uint64
+			err = json.Unmarshal(r, &n)
+			args[i] = n
+		default:
+			err = fmt.Errorf("unsupported type %q", typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument #%d: %v", i, err)
+		}
+	}
+	return args, nil
+}
+
+// 解码4字节长度前缀+数据的返回值
+func readLenPrefixed(p uintptr) ([]byte, error) {
+	if p == 0 {
+		return nil, errors.New("null pointer")
+	}
+	n := binary.LittleEndian.Uint32(readMemory(p, 4))
+	return readMemory(p+4, int(n)), nil
+}
+
+// 解码指向GoString（指针、长度）的返回值
+func readGoString(p uintptr) string {
+	header := readMemory(p, 16)
+	data := uintptr(binary.LittleEndian.Uint64(header[0:8]))
+	n := int(binary.LittleEndian.Uint64(header[8:16]))
+	if n == 0 {
+		return ""
+	}
+	return string(readMemory(data, n))
+}
+
+// 解码 int32个数+(int32长度+字符串)* 格式的返回值
+func readStringList(p uintptr) []string {
+	readInt32 := func() int {
+		n := int32(binary.LittleEndian.Uint32(readMemory(p, 4)))
+		p += 4
+		return int(n)
+	}
+	list := make([]string, readInt32())
+	for i := range list {
+		n := readInt32()
+		list[i] = string(readMemory(p, n))
+		p += uintptr(n)
+	}
+	return list
+}
+
+// 描述参数列表，用于错误信息
+func describeParams(params []Param) string {
+	s := ""
+	for i, param := range params {
+		if i > 0 {
+			s += ", "
+		}
+		s += param.Name + " " + param.Type
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// inspectReport builder inspect 的输出
+type inspectReport struct {
+	Path      string      `json:"path"`
+	Format    string      `json:"format"`  // elf、pe或macho
+	Exports   []string    `json:"exports"` // 动态库导出的插件符号（PluginWrapper等）
+	GoVersion string      `json:"go_version,omitempty"`
+	Module    string      `json:"module,omitempty"`
+	Deps      []string    `json:"deps,omitempty"`     // 依赖模块，格式为 path@version
+	Settings  []string    `json:"settings,omitempty"` // 构建参数，格式为 key=value
+	Meta      *pluginMeta `json:"metadata"`           // 插件元数据，没有时为null
+}
+
+// runInspect 实现 builder inspect [-json] lib：读取构建出的插件动态库的导出符号、Go构建信息与插件元数据
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder inspect [-json] pluginLib")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	report, err := inspectPlugin(fs.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	printInspectReport(os.Stdout, report)
+}
+
+// inspectPlugin 读取动态库，不加载也不执行其中的代码，因此可以检查其他平台构建出的插件
+func inspectPlugin(path string) (*inspectReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &inspectReport{Path: path}
+	symbols, err := readExports(report, data)
+	if err != nil {
+		return nil, err
+	}
+	pluginSymbols := []string{abi.Exports.Wrapper, abi.Exports.NewInstance, abi.Exports.Call,
+		abi.Exports.FreeInstance, abi.Exports.Metadata}
+	report.Exports = make([]string, 0)
+	for _, sym := range pluginSymbols {
+		if symbols[sym] {
+			report.Exports = append(report.Exports, sym)
+		}
+	}
+	if info, err := buildinfo.Read(bytes.NewReader(data)); err == nil {
+		report.GoVersion = info.GoVersion
+		report.Module = info.Main.Path
+		for _, dep := range info.Deps {
+			report.Deps = append(report.Deps, dep.Path+"@"+dep.Version)
+		}
+		for _, setting := range info.Settings {
+			report.Settings = append(report.Settings, setting.Key+"="+setting.Value)
+		}
+	}
+	report.Meta = findPluginMeta(data)
+	return report, nil
+}
+
+// 按文件格式读取导出的函数名，并记录格式
+func readExports(report *inspectReport, data []byte) (map[string]bool, error) {
+	r := bytes.NewReader(data)
+	symbols := make(map[string]bool)
+	if f, err := elf.NewFile(r); err == nil {
+		report.Format = "elf"
+		syms, err := f.DynamicSymbols()
+		if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+			return nil, err
+		}
+		for _, sym := range syms {
+			if sym.Section != elf.SHN_UNDEF && elf.ST_TYPE(sym.Info) == elf.STT_FUNC {
+				symbols[sym.Name] = true
+			}
+		}
+		return symbols, nil
+	}
+	if f, err := macho.NewFile(r); err == nil {
+		report.Format = "macho"
+		if f.Symtab != nil {
+			for _, sym := range f.Symtab.Syms {
+				if sym.Sect != 0 && sym.Type&0x01 != 0 { // N_EXT
+					symbols[strings.TrimPrefix(sym.Name, "_")] = true
+				}
+			}
+		}
+		return symbols, nil
+	}
+	if f, err := pe.NewFile(r); err == nil {
+		report.Format = "pe"
+		names, err := readPeExports(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			symbols[name] = true
+		}
+		return symbols, nil
+	}
+	return nil, errors.New("unknown file format, expected ELF, PE or Mach-O")
+}
+
+// debug/pe不解析导出表，这里读取导出目录（IMAGE_EXPORT_DIRECTORY）中的函数名
+func readPeExports(f *pe.File) ([]string, error) {
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > 0 {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > 0 {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	}
+	if dir.VirtualAddress == 0 {
+		return nil, nil
+	}
+	// 读取rva处的n字节
+	read := func(rva uint32, n int) ([]byte, error) {
+		for _, s := range f.Sections {
+			if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+				buf := make([]byte, n)
+				_, err := s.ReadAt(buf, int64(rva-s.VirtualAddress))
+				if err != nil && err != io.EOF {
+					return nil, err
+				}
+				return buf, nil
+			}
+		}
+		return nil, fmt.Errorf("bad export table: rva %#x is not in any section", rva)
+	}
+	header, err := read(dir.VirtualAddress, 40)
+	if err != nil {
+		return nil, err
+	}
+	numberOfNames := binary.LittleEndian.Uint32(header[24:28])
+	addressOfNames := binary.LittleEndian.Uint32(header[32:36])
+	nameRvas, err := read(addressOfNames, int(numberOfNames)*4)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, numberOfNames)
+	for i := uint32(0); i < numberOfNames; i++ {
+		name, err := read(binary.LittleEndian.Uint32(nameRvas[i*4:]), 256)
+		if err != nil {
+			return nil, err
+		}
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+		names = append(names, string(name))
+	}
+	return names, nil
+}
+
+// 在动态库中查找包装模板嵌入的元数据JSON，元数据总是以 {"fuzzgiu_plugin": 开头
+func findPluginMeta(data []byte) *pluginMeta {
+	marker := []byte(`{"fuzzgiu_plugin":`)
+	for off := 0; ; {
+		i := bytes.Index(data[off:], marker)
+		if i < 0 {
+			return nil
+		}
+		off += i
+		meta := new(pluginMeta)
+		if err := json.NewDecoder(bytes.NewReader(data[off:])).Decode(meta); err == nil && meta.Type != "" {
+			return meta
+		}
+		off += len(marker)
+	}
+}
+
+func printInspectReport(out io.Writer, report *inspectReport) {
+	fmt.Fprintf(out, "file:     %s (%s)\n", report.Path, report.Format)
+	exports := strings.Join(report.Exports, ", ")
+	if exports == "" {
+		exports = "none, not a FuzzGIU plugin?"
+	}
+	fmt.Fprintf(out, "exports:  %s\n", exports)
+	if report.GoVersion != "" {
+		fmt.Fprintf(out, "go:       %s\n", report.GoVersion)
+	}
+	if report.Module != "" {
+		fmt.Fprintf(out, "module:   %s\n", report.Module)
+	}
+	for _, dep := range report.Deps {
+		fmt.Fprintf(out, "dep:      %s\n", dep)
+	}
+	for _, setting := range report.Settings {
+		fmt.Fprintf(out, "build:    %s\n", setting)
+	}
+	meta := report.Meta
+	if meta == nil {
+		fmt.Fprintln(out, "metadata: none (built by an older builder)")
+		return
+	}
+	mode := "function"
+	if meta.Instance {
+		mode = "instance"
+	}
+	fmt.Fprintf(out, "type:     %s (%s, %s mode)\n", meta.Type, meta.Function, mode)
+	params, _ := joinParams(meta.Params)
+	fmt.Fprintf(out, "params:   (%s)\n", params)
+	if meta.Instance {
+		ctorParams, _ := joinParams(meta.CtorParams)
+		fmt.Fprintf(out, "ctor:     (%s)\n", ctorParams)
+	}
+	concurrency := "unlimited"
+	if meta.Concurrency > 0 {
+		concurrency = fmt.Sprint(meta.Concurrency)
+	}
+	fmt.Fprintf(out, "calls:    %s concurrent\n", concurrency)
+	if meta.FuzzTypes != "" {
+		fmt.Fprintf(out, "schema:   fuzzTypes v%s\n", meta.FuzzTypes)
+	}
+	if r := meta.Repro; r != nil {
+		fmt.Fprintf(out, "repro:    %s %s, %s; template %s, plugin %s, fuzzTypes %s, deps %s, modules %s\n",
+			r.GoVersion, r.Target, r.CC, r.Template, r.Plugin, r.FuzzTypes, r.Deps, r.Modules)
+	}
+}
@@ -1,225 +1,184 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"strings"
+	"time"
 )
 
 /*
 	-t 模板类型
 	-o 输出路径
 	-path 文件路径
-	-gopath 使用的golang路径
-	-g 指定目录，在目录下生成一个环境包含fuzztype库和特定类型的plugin
+	-gopath 使用的golang路径，builder build/test可以用逗号分隔多个工具链，依次构建与测试以检查兼容性
+	-g 指定目录，在目录下生成插件开发环境：可以直接构建的示例插件、用例、plugin_test.go、README、fuzzgiu.json，
+	  go.mod以require加本地replace引用构建器中的fuzzTypes SDK（fuzzTypes目录，版本为其SchemaVersion），不需要联网。
+	  SDK中还有fuzzTypes/reactSDK（按引擎的语义评估filter与matcher）与fuzzTypes/sendSDK（按SendMeta发送HTTP请求），reqSender的示例基于sendSDK
 	builder -t plgen/reactor/plproc/preproc -path pluginFile.go -o xxx.dll
 	builder -t xxx -g C:/path/
-	-> go -buildmode=c-shared wrappedPlugin.go -o xxx.dll
+	builder -gen C:/path/ -update  只更新已生成项目require的fuzzTypes SDK版本（旧项目为复制的fuzzTypes.go，列出类型的变化）与go.mod中的Go版本，不修改插件代码
+	-gen 不覆盖已存在的文件，除非指定-force
+	builder -t xxx -into C:/monorepo/ -gen plugins/xxx  在已有的模块中生成插件包，导入路径由模块路径计算，
+	  各插件共用fuzzTypes SDK（模块中没有时在go.mod中require）或已有的fuzzTypes包；-into为go.work所在目录时插件为新模块并加入go.work
+	builder build -t xxx [-watch [-test]] pluginDir  构建插件，-watch在文件变化后自动重新构建
+	builder build -manifest plugins.json [-j 4]  按清单并发构建多个插件
+	builder cache ls|prune|dir  查看或清理构建缓存，缓存键相同时直接复用之前的构建产物
+	builder test -t xxx [-fixtures dir] pluginDir  使用用例测试插件
+	builder call [-fixture file] [-args json] xxx.so  以FuzzGIU的方式加载并调用构建出的插件
+	builder validate -t xxx pluginDir  只做签名与类型检查，不链接
+	builder schema [-o dir] [Fuzz|Req|Resp|Reaction|SendMeta|fixture[.reactor]]  由fuzzTypes结构体的json tag与注释生成JSON Schema
+	builder validate-json [-t xxx] job|Req|...|fixture file...  按JSON Schema检查任务文件与用例，列出不符合的字段
+	builder inspect [-json] xxx.so  查看插件的类型、参数、导出符号与构建信息
+	builder doctor [-targets windows/amd64] [-manifest plugins.json]  检查Go、cgo、C编译器、交叉编译器、模板与输出目录，给出修复方法
+	builder verify-repro pluginDir xxx.so  以-repro重新构建插件并与xxx.so比较，证明其由该源码构建，不一致时列出不同的输入
+	builder build -json ...  以每行一个JSON对象输出构建阶段、定位到源文件的诊断信息、构建产物（路径与sha256）与耗时
+	builder abi [-check]  根据templates/abi.json重新生成包装模板、host/fuzzgiu_plugin.h与host/abi_gen.go
+	-> go build -buildmode=c-shared -o xxx.dll .  （插件路径为文件时为 go build ... ./wrappedPlugin.go）
 	参数
 	-t 必须
 	-o, -path -o非必须，未指定则使用pluginFunName，-path如果不使用-g则必须，如果使用-g，这两项被忽略
 	-g, -gopath 非必须
+	-tags, -trimpath, -strip, -ldflags, -gcflags, -race, -env KEY=VALUE 传给go build，也可以写在插件目录下的fuzzgiu.json中
+	-mod readonly/vendor/mod 传给go build，-mod=vendor使用模块的vendor目录离线构建
+	-fuzztypes-drift error/warn/off 插件引用的fuzzTypes（复制的副本或其他版本的SDK）与构建器中的SDK比较，
+	  缺少类型或字段、JSON tag改名、字段类型或常量值变化时默认构建失败并列出差异，warn只警告
+	-repro 可复现构建：固定-trimpath、-buildvcs=false与build ID，在固定路径的工作区中构建，并将输入摘要写入插件元数据
+	插件总以模块模式构建，插件目录（或其上级目录）中必须有go.mod，go.work与replace由go命令按常规方式处理。
+	插件路径为目录时以包模式构建：包装文件与目录下的所有文件（plugin.go、其他.go文件、C文件）编译为同一个包，
+	插件可以拆分为多个文件并引用模块中的其他包；插件路径为文件时只编译该文件（包装文件内联插件源码）
+	退出码（builder build与 builder -build）：0 成功，1 其他失败（如用例不通过），2 参数错误，3 插件无法解析、签名不符或fuzzTypes不兼容，
+	4 编译失败，5 环境问题（Go工具链、cgo、C编译器、模块、模板）
+	插件有两种写法
+	1.函数模式：直接定义插件函数（如React），导出PluginWrapper
+	2.实例模式：定义结构体与构造函数（如 func NewReactor(args) *MyReactor），结构体实现插件函数同名的方法，
+	  导出NewInstance(构造参数) handle、Call(handle, 插件参数)和FreeInstance(handle)，实例保存在并发安全的句柄表中
 */
 
 func main() {
+	if len(os.Args) > 1 { // 子命令
+		switch os.Args[1] {
+		case "build":
+			runBuild(os.Args[2:])
+			return
+		case "cache":
+			runCache(os.Args[2:])
+			return
+		case "test":
+			runTest(os.Args[2:])
+			return
+		case "call":
+			runCall(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		case "abi":
+			runAbi(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "schema":
+			runSchema(os.Args[2:])
+			return
+		case "validate-json":
+			runValidateJson(os.Args[2:])
+			return
+		case "verify-repro":
+			runVerifyRepro(os.Args[2:])
+			return
+		}
+	}
 	templateType := flag.String("t", "", "template type, can be "+
 		"payloadProc,reactor,payloadGen,reqSender or preprocess")
-	pluginPath := flag.String("build", "", "plugin file or directory to build the plugin. "+
-		"if the path is directory, file \"plugin.go\" in the directory will be used")
-	outputFileName := flag.String("o", "", "output file name")
-	goPath := flag.String("gopath", "", "go binary path be used to build the plugin")
+	opt := &buildOptions{}
+	flag.StringVar(&opt.PluginPath, "build", "", "plugin file or directory to build the plugin. "+
+		"if the path is directory, the plugin function is looked up in \"plugin.go\" and "+
+		"the whole package in the directory is built")
 	genPath := flag.String("gen", "", "path to generate go project for plugin"+
 		"(collocate with -t)")
-	keepIntermidiate := flag.Bool("keep-intermediate", false, "keep intermediate files")
+	genForce := flag.Bool("force", false, "let -gen overwrite files that already exist")
+	genInto := flag.String("into", "", "with -gen, add the plugin as a package of the existing module in this directory "+
+		"(-gen is then relative to it) and share the fuzzTypes SDK (or an existing fuzzTypes package). a directory with go.work but no go.mod "+
+		"gets the plugin as a new module added to the workspace")
+	genUpdate := flag.Bool("update", false, "with -gen, only update the required fuzzTypes SDK version "+
+		"(or the copied fuzzTypes.go of older projects) and the go version in go.mod of an existing plugin project, -t is not needed")
+	applyConfig := addBuildFlags(flag.CommandLine, opt)
 	flag.Parse()
+	start := time.Now()
+	var out io.Writer = os.Stdout
+	if opt.JSON { // -json时标准输出只有事件，与builder build -json相同
+		out = io.Discard
+		opt.Events = newEventWriter(os.Stdout)
+	}
+	exit := func(err error) {
+		if !opt.JSON {
+			fmt.Println(err)
+		}
+		opt.Events.summary(err, 0, 1, time.Since(start))
+		os.Exit(exitCode(err))
+	}
 	//
-	if *genPath == "" && *pluginPath == "" { // 编译插件和生成开发目录必须至少一个
-		fmt.Println("plugin path or generate path is required")
-		os.Exit(1)
+	if *genPath == "" && opt.PluginPath == "" { // 编译插件和生成开发目录必须至少一个
+		exit(classify(exitUsage, fmt.Errorf("plugin path or generate path is required")))
+	}
+	if *genUpdate && *genPath == "" {
+		exit(classify(exitUsage, fmt.Errorf("-update needs the plugin project in -gen")))
 	}
-	if *templateType == "" {
-		fmt.Println("template type is required")
-		os.Exit(1)
+	if *templateType == "" && !*genUpdate {
+		exit(classify(exitUsage, fmt.Errorf("template type is required")))
 	}
-	if *goPath == "" { // 未指明golang路径，直接执行go命令
-		*goPath = "go"
+	if len(splitToolchains(opt.GoPath)) > 1 {
+		exit(classify(exitUsage, fmt.Errorf("multiple toolchains in -gopath are supported by builder build and builder test")))
 	}
-	goVersion := exec.Command(*goPath, "version")
-	goVer, err := goVersion.Output()
+	toolchain, err := detectToolchain(opt.GoPath, nil)
 	if err != nil { // 执行失败，说明golang环境无效
-		panic(err)
+		exit(classify(exitEnvironment, err))
+	}
+	fmt.Fprintf(out, "Using go version - %s (%s/%s)\n", toolchain.Version, toolchain.GOOS, toolchain.GOARCH)
+	if !toolchain.CGOEnabled && *genPath == "" {
+		exit(classify(exitEnvironment, fmt.Errorf("cgo is disabled (CGO_ENABLED=0), plugins are built with "+
+			"-buildmode=c-shared which needs cgo and a C compiler, run builder doctor for details")))
 	}
-	goVer = bytes.Split(goVer, []byte(" "))[2][2:] // 获取golang版本
-	fmt.Printf("Using go version - %s\n", goVer)
-	var pluginFunName string
 	// 根据不同类型的插件，查找不同的函数名
-	switch *templateType {
-	case "payloadProc":
-		pluginFunName = "PayloadProcessor"
-	case "reactor":
-		pluginFunName = "React"
-	case "payloadGen":
-		pluginFunName = "PayloadGenerator"
-	case "preprocess":
-		pluginFunName = "Preprocessor"
-	case "reqSender":
-		pluginFunName = "ReqSender"
-	default:
-		fmt.Printf("Unsupported template type: %s\n", *templateType)
-		os.Exit(1)
-	}
-	/*
-		在指定目录下生成插件开发环境：
-			1.创建plugin.go, go.mod, 将fuzzTypes.go复制到components/fuzzTypes/fuzzTypes.go
-			2.根据templateType从gotmp模板中选择一个，把函数取出来填写到plugin.go中
-	*/
+	pluginFunName := getPluginFunName(*templateType)
+	if pluginFunName == "" && !*genUpdate {
+		exit(classify(exitUsage, fmt.Errorf("Unsupported template type: %s", *templateType)))
+	}
+	// 在指定目录下生成插件开发环境，包括示例插件、用例、测试与说明，见gen
 	if *genPath != "" {
-		gen(genPath, templateType, pluginFunName, goVer)
+		gen(&genOptions{Path: *genPath, TemplateType: *templateType, PluginFunName: pluginFunName,
+			Force: *genForce, Update: *genUpdate, Into: *genInto}, toolchain)
 		return
 	}
-	fmt.Println("Plugin type: " + pluginFunName)
-	if *outputFileName == "" {
-		*outputFileName = "FuzzGIU" + pluginFunName + ".dll"
-		fmt.Printf("Output file name %s\n", *outputFileName)
-	}
-	isFile, err := IsFile(*pluginPath)
-	if err != nil {
-		panic(err)
-	}
-
-	if !isFile { // 如果路径是目录，则采用目录下的plugin.go文件
-		*pluginPath += "/plugin.go"
-	}
-	// 获取插件文件的相关信息
-	pluginImports, err := getImports(*pluginPath)
-	if err != nil {
-		panic(err)
-	}
-	params, err := getFuncParams(*pluginPath, pluginFunName) // 解析插件文件的函数参数列表
-	if err != nil {
-		panic(err)
-	}
-	completeParamList := params
-	retType, err := getFuncReturnType(*pluginPath, pluginFunName) // 解析返回类型
-	if err != nil {
-		panic(err)
-	}
-	code, err := GetCodes(*pluginPath) // 获取文件中的源码部分（import之后开始的部分）
-	if err != nil {
-		panic(err)
-	}
-	// 判断插件函数参数列表的函数签名是否符合定义，并删去params列表中的固定参数
-	switch *templateType {
-	case "payloadProc":
-		if params[0].Type != "string" || params[0].Name != "payload" ||
-			retType != "string" {
-			fmt.Println("bad function definition, example: " +
-				"PayloadProcessor(payload string, {custom arguments}) string")
-			os.Exit(1)
-		}
-		params = params[1:]
-	case "reactor":
-		if params[0].Type != "*fuzzTypes.Req" || params[0].Name != "request" ||
-			params[1].Type != "*fuzzTypes.Resp" || params[1].Name != "resp" ||
-			retType != "*fuzzTypes.Reaction" {
-			fmt.Println("bad function definition, example: " +
-				"React(request *fuzzTypes.Req, resp *fuzzTypes.Resp, {custom arguments}) *fuzzTypes.Reaction")
-			os.Exit(1)
-		}
-		params = params[2:]
-	case "preprocess":
-		if params[0].Type != "*fuzzTypes.Fuzz" || params[0].Name != "fuzz" ||
-			retType != "*fuzzTypes.Fuzz" {
-			fmt.Println("bad function definition, example: " +
-				"Preprocessor(fuzz fuzzTypes.Fuzz, {custom arguments}) *fuzzTypes.Fuzz")
-			os.Exit(1)
-		}
-		params = params[1:]
-	case "payloadGen":
-		if retType != "[]string" {
-			fmt.Println("bad function definition, example: " +
-				"PayloadGenerator({custom arguments}) []string")
-			os.Exit(1)
-		}
-	case "reqSender":
-		if params[0].Type != "*fuzzTypes.SendMeta" || params[0].Name != "sendMeta" ||
-			retType != "*fuzzTypes.Resp" {
-			fmt.Println("bad function definition, example: " +
-				"ReqSender(sendMeta *fuzzTypes.SendMeta, {custom arguments}) *fuzzTypes.Resp")
-			os.Exit(1)
-		}
-	}
-
-	formalParamsStr := ""
-	actualParamsStr := ""
-	for i, param := range params { // 拼接参数字符串
-		formalParamsStr += fmt.Sprintf("%s %s", param.Name, param.Type)
-		actualParamsStr += param.Name
-		if i != len(params)-1 {
-			formalParamsStr += ", "
-			actualParamsStr += ", "
-		}
+	fmt.Fprintln(out, "Plugin type: "+pluginFunName)
+	opt.TemplateType = *templateType
+	if err = applyConfig(os.Args[1:], opt.PluginPath); err != nil {
+		exit(classify(exitUsage, err))
 	}
-	// 模板文件名，格式为tmpl+首字母大写的插件类型+.gotmp，在当前目录的templates子目录下
-	tmplFileName := "templates/" + "tmpl" +
-		strings.ToUpper((*templateType)[:1]) + (*templateType)[1:] + ".gotmp"
-	tmplImports, err := getImports(tmplFileName)
-	// 去除插件go文件中与模板文件重合的import
-	for i, pImport := range pluginImports {
-		for _, tImport := range tmplImports {
-			if pImport == tImport {
-				pluginImports[i] = ""
-				break
-			}
-		}
-	}
-	dedupImports := "import (\n"
-	// custom import语句
-	for _, pImport := range pluginImports {
-		dedupImports += fmt.Sprintf("\t%s\n", pImport)
+	if opt.Output == "" {
+		fmt.Fprintf(out, "Output file name %s\n", opt.outputName())
 	}
-	dedupImports += ")"
+	result, err := buildPlugin(opt, out)
 	if err != nil {
-		panic(err)
+		exit(err)
 	}
-	tmpl, err := os.ReadFile(tmplFileName)
-	if err != nil {
-		panic(err)
-	}
-	// 将模板文件与插件文件合并
-	tmpl = bytes.Replace(tmpl, []byte("/* FORMAL PARAMETERS */"), []byte(formalParamsStr), -1)
-	tmpl = bytes.Replace(tmpl, []byte("/* ACTUAL PARAMETERS */"), []byte(actualParamsStr), -1)
-	tmpl = bytes.Replace(tmpl, []byte("/* CODE */"), []byte(code), -1)
-	tmpl = bytes.Replace(tmpl, []byte("/* CUSTOM IMPORTS */"), []byte(dedupImports), -1)
-	dir, _ := GetFileDir(*pluginPath)
-	err = os.Chdir(dir) // 切换到插件所在目录
-	if err != nil {
-		panic(err)
+	src := result.Source
+	if result.Cached {
+		fmt.Fprintf(out, "Using cached build %s\n", result.CacheKey[:12])
 	}
-	wrappedPlugin, err := os.Create("wrappedPlugin.go") // 编译过程中生成的临时文件
-	if err != nil {
-		panic(err)
+	if src.Instance {
+		fmt.Fprintf(out, "Instance type: %s, constructor parameters - %v\n", src.InstanceType, src.CtorParams)
 	}
-	_, err = wrappedPlugin.Write(tmpl)
-	if err != nil {
-		panic(err)
-	}
-	wrappedPlugin.Close()
-	if !*keepIntermidiate {
-		defer os.Remove("wrappedPlugin.go")                                // 临时文件编译结束后删除
-		defer os.Remove(strings.Replace(*outputFileName, ".dll", ".h", 1)) // 删除编译时生成的.h文件
-	}
-	build := exec.Command(*goPath, "build", "-buildmode=c-shared", "-ldflags=-s", "-ldflags=-w", "-o",
-		*outputFileName, "./wrappedPlugin.go")
-	output, err := build.CombinedOutput()
-	fmt.Println(string(output))
-	if err != nil {
-		panic(err)
+	fmt.Fprintf(out, "Successfully built %s, plugin type - %s\n", opt.outputName(), *templateType)
+	fmt.Fprintf(out, "Plugin parameters - %v\n", src.AllParams)
+	if src.Concurrency > 0 {
+		fmt.Fprintf(out, "Concurrency - %d\n", src.Concurrency)
 	}
-	fmt.Printf("Successfully built %s, plugin type - %s\n", *outputFileName, *templateType)
-	fmt.Printf("Plugin parameters - %v", completeParamList)
-	return
+	opt.Events.summary(nil, 1, 0, time.Since(start))
 }
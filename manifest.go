@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginManifest 批量构建的清单文件（如plugins.json），其中的相对路径相对于清单文件所在目录：
+//
+//	{
+//	  "workers": 4,
+//	  "plugins": [
+//	    {"path": "reactors/keyword", "type": "reactor", "output": "out/keyword_{goos}_{goarch}{ext}",
+//	     "targets": ["linux/amd64", "windows/amd64"], "serial": true,
+//	     "tags": "netgo", "env": {"CC": "zig cc"}}
+//	  ]
+//	}
+//
+// output中可以使用{goos}、{goarch}与{ext}（目标平台的动态库扩展名），省略时为插件目录下的 FuzzGIU+插件函数名+{ext}，
+// 有多个targets而output中没有{goos}、{goarch}时在扩展名前追加 _goos_goarch。targets省略时只构建本机平台。
+// tags、trimpath、strip、ldflags、gcflags、race与env的含义与构建配置文件（见buildConfig）相同
+type pluginManifest struct {
+	Workers int              `json:"workers"`
+	Plugins []*manifestEntry `json:"plugins"`
+}
+
+// manifestEntry 清单中的单个插件
+type manifestEntry struct {
+	Path             string   `json:"path"`
+	Type             string   `json:"type"`
+	Output           string   `json:"output"`
+	Targets          []string `json:"targets"` // goos/goarch
+	Serial           bool     `json:"serial"`
+	Concurrency      *int     `json:"concurrency"` // 省略时使用源文件中的指令
+	KeepIntermediate bool     `json:"keep_intermediate"`
+	buildConfig               // go build参数，如tags、ldflags，env中可以指定交叉编译使用的CC
+}
+
+// 单个插件在单个目标平台上的构建结果
+type manifestResult struct {
+	Entry    *manifestEntry
+	Target   string
+	Output   string
+	Err      error
+	Log      string
+	Duration time.Duration
+	Cached   bool
+}
+
+// 读取清单文件，并将其中的相对路径转换为绝对路径
+func loadManifest(path string) (*pluginManifest, error) {
+	m := new(pluginManifest)
+	if err := readJsonFile(path, m); err != nil {
+		return nil, err
+	}
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range m.Plugins {
+		if entry.Path == "" || entry.Type == "" {
+			return nil, fmt.Errorf("%s: plugins[%d]: path and type are required", path, i)
+		}
+		if getPluginFunName(entry.Type) == "" {
+			return nil, fmt.Errorf("%s: plugins[%d]: unsupported template type: %s", path, i, entry.Type)
+		}
+		for _, target := range entry.Targets {
+			if strings.Count(target, "/") != 1 {
+				return nil, fmt.Errorf("%s: plugins[%d]: bad target %q, expected goos/goarch", path, i, target)
+			}
+		}
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(base, entry.Path)
+		}
+		if entry.Output != "" && !filepath.IsAbs(entry.Output) {
+			entry.Output = filepath.Join(base, entry.Output)
+		}
+	}
+	return m, nil
+}
+
+// 各平台动态库的扩展名
+func sharedLibExt(goos string) string {
+	switch goos {
+	case "windows":
+		return ".dll"
+	case "darwin", "ios":
+		return ".dylib"
+	}
+	return ".so"
+}
+
+// 插件在目标平台上的输出文件名，target为空表示本机平台
+func (entry *manifestEntry) outputFor(target string) string {
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if target != "" {
+		parts := strings.SplitN(target, "/", 2)
+		goos, goarch = parts[0], parts[1]
+	}
+	output := entry.Output
+	if output == "" {
+		output = filepath.Join(entry.Path, "FuzzGIU"+getPluginFunName(entry.Type)+"{ext}")
+	}
+	output = strings.Replace(output, "{ext}", sharedLibExt(goos), -1)
+	if len(entry.Targets) > 1 && !strings.Contains(output, "{goos}") && !strings.Contains(output, "{goarch}") {
+		ext := filepath.Ext(output)
+		output = strings.TrimSuffix(output, ext) + "_{goos}_{goarch}" + ext
+	}
+	return strings.NewReplacer("{goos}", goos, "{goarch}", goarch).Replace(output)
+}
+
+// 插件在目标平台上的构建参数，以命令行中指定的参数defaults为基础，清单中出现的字段优先
+func (entry *manifestEntry) buildOptions(target string, defaults *buildOptions) *buildOptions {
+	opt := &buildOptions{
+		TemplateType:     entry.Type,
+		PluginPath:       entry.Path,
+		Output:           entry.outputFor(target),
+		GoPath:           defaults.GoPath,
+		KeepIntermediate: entry.KeepIntermediate || defaults.KeepIntermediate,
+		NoCache:          defaults.NoCache,
+		Serial:           entry.Serial,
+		Concurrency:      -1,
+		Env:              append([]string(nil), defaults.Env...),
+		Tags:             defaults.Tags,
+		Trimpath:         defaults.Trimpath,
+		Strip:            defaults.Strip,
+		Ldflags:          defaults.Ldflags,
+		Gcflags:          defaults.Gcflags,
+		Race:             defaults.Race,
+		Repro:            defaults.Repro,
+		Mod:              defaults.Mod,
+		FuzzTypesDrift:   defaults.FuzzTypesDrift,
+		Target:           target,
+		Events:           defaults.Events,
+	}
+	if entry.Concurrency != nil {
+		opt.Concurrency = *entry.Concurrency
+	}
+	entry.buildConfig.apply(opt)
+	if target != "" {
+		parts := strings.SplitN(target, "/", 2)
+		opt.Env = append(opt.Env, "GOOS="+parts[0], "GOARCH="+parts[1], "CGO_ENABLED=1")
+	}
+	return opt
+}
+
+// buildManifest 按清单并发构建插件，workers为0时使用清单中的workers或CPU数。
+// 每个插件的各个目标平台依次构建（构建时会在插件目录下写入wrappedPlugin.go），不同插件之间并发。
+// 返回成功与失败的构建数，有构建失败时返回的错误取各失败中最大的退出码
+func buildManifest(path string, workers int, defaults *buildOptions, out io.Writer) (built, failed int, err error) {
+	m, err := loadManifest(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if workers <= 0 {
+		workers = m.Workers
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	// 同一目录下的插件共用wrappedPlugin.go，按目录分组后组内依次构建
+	var groups [][]*manifestEntry
+	groupOf := make(map[string]int)
+	for _, entry := range m.Plugins {
+		dir := entry.Path
+		if isFile, err := IsFile(dir); err == nil && isFile {
+			dir = filepath.Dir(dir)
+		}
+		i, ok := groupOf[dir]
+		if !ok {
+			i = len(groups)
+			groupOf[dir] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], entry)
+	}
+	jobs := make(chan []*manifestEntry)
+	results := make(chan *manifestResult)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				for _, entry := range group {
+					targets := entry.Targets
+					if len(targets) == 0 {
+						targets = []string{""}
+					}
+					for _, target := range targets {
+						results <- buildManifestEntry(entry, target, defaults)
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, group := range groups {
+			jobs <- group
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	// 按完成顺序输出每个构建的结果，插件路径相对于清单文件所在目录显示
+	base, _ := filepath.Abs(filepath.Dir(path))
+	code := 0
+	for result := range results {
+		name := result.Entry.Path
+		if rel, err := filepath.Rel(base, name); err == nil {
+			name = rel
+		}
+		if result.Target != "" {
+			name += " (" + result.Target + ")"
+		}
+		if result.Err != nil {
+			failed++
+			if c := exitCode(result.Err); c > code {
+				code = c
+			}
+			fmt.Fprintf(out, "FAIL %s: %v\n%s", name, result.Err, result.Log)
+			continue
+		}
+		built++
+		cached := ""
+		if result.Cached {
+			cached = ", cached"
+		}
+		fmt.Fprintf(out, "ok   %s -> %s (%.1fs%s)\n", name, result.Output, result.Duration.Seconds(), cached)
+	}
+	fmt.Fprintf(out, "%d built, %d failed\n", built, failed)
+	if failed > 0 {
+		return built, failed, &builderError{Code: code, Err: fmt.Errorf("%d of %d builds failed", failed, built+failed)}
+	}
+	return built, failed, nil
+}
+
+func buildManifestEntry(entry *manifestEntry, target string, defaults *buildOptions) *manifestResult {
+	opt := entry.buildOptions(target, defaults)
+	start := time.Now()
+	log := bytes.Buffer{}
+	result, err := buildPlugin(opt, &log)
+	return &manifestResult{Entry: entry, Target: target, Output: opt.Output, Err: err,
+		Log: log.String(), Duration: time.Since(start), Cached: err == nil && result.Cached}
+}
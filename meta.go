@@ -0,0 +1,31 @@
+package main
+
+// 元数据格式版本，元数据JSON总以 {"fuzzgiu_plugin": 开头，可据此在插件二进制文件中定位元数据
+const pluginMetaVersion = 1
+
+// pluginMeta 插件元数据，以JSON字符串嵌入插件，并通过导出函数PluginMetadata返回（4字节长度前缀+JSON）
+type pluginMeta struct {
+	Version     int          `json:"fuzzgiu_plugin"`
+	Type        string       `json:"type"`     // 模板类型，如reactor
+	Function    string       `json:"function"` // 插件函数名，如React
+	Params      []Param      `json:"params"`   // 调用时需要传入的自定义参数
+	Instance    bool         `json:"instance"` // 是否为实例模式
+	CtorParams  []Param      `json:"ctor_params,omitempty"`
+	Concurrency int          `json:"concurrency"`          // 同时进入插件函数的最大调用数，0表示不限制
+	Repro       *reproInputs `json:"repro,omitempty"`      // 可复现构建的输入摘要，仅-repro构建时存在
+	FuzzTypes   string       `json:"fuzz_types,omitempty"` // 插件引用的fuzzTypes SDK的SchemaVersion，未引用或引用旧版本的副本时为空
+}
+
+func newPluginMeta(src *pluginSource) *pluginMeta {
+	return &pluginMeta{
+		Version:     pluginMetaVersion,
+		Type:        src.TemplateType,
+		Function:    src.FunName,
+		Params:      src.Params,
+		Instance:    src.Instance,
+		CtorParams:  src.CtorParams,
+		Concurrency: src.Concurrency,
+		Repro:       src.Repro,
+		FuzzTypes:   src.FuzzTypes,
+	}
+}
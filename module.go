@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// goModule 插件所在的模块。插件总以模块模式构建，go.work、replace与vendor目录由go命令按常规方式处理
+type goModule struct {
+	Root   string // go.mod所在目录
+	GoWork string // 生效的go.work，没有或GOWORK=off时为空
+}
+
+// findModule 定位dir所在的模块，dir不在模块中时返回错误
+func findModule(opt *buildOptions, dir string) (*goModule, error) {
+	env, err := goEnv(opt, dir, "GOMOD", "GOWORK")
+	if err != nil {
+		return nil, err
+	}
+	switch gomod := env["GOMOD"]; gomod {
+	case os.DevNull:
+		return nil, fmt.Errorf("%s is not in a Go module: no go.mod in it or any parent directory, "+
+			"create one with \"go mod init\" or builder -gen", dir)
+	case "":
+		return nil, fmt.Errorf("module mode is disabled (GO111MODULE=off), plugins must be built in module mode")
+	default:
+		mod := &goModule{Root: filepath.Dir(gomod), GoWork: env["GOWORK"]}
+		if mod.GoWork == "off" {
+			mod.GoWork = ""
+		}
+		return mod, nil
+	}
+}
+
+// go命令输出中常见的模块问题与对应的修复方法，%s为匹配到的包路径
+var goErrorHints = []struct {
+	re   *regexp.Regexp
+	hint string
+}{
+	{regexp.MustCompile(`missing go\.sum entry for module providing package (\S+)`),
+		`go.sum has no entry for the module providing %s, run "go mod tidy" in the plugin module`},
+	{regexp.MustCompile(`missing go\.sum entry`),
+		`go.sum is missing entries, run "go mod tidy" in the plugin module`},
+	{regexp.MustCompile(`cannot find module providing package (\S+): import lookup disabled by -mod=vendor`),
+		`package %s is not vendored, run "go mod vendor" in the plugin module`},
+	{regexp.MustCompile(`no required module provides package (\S+?);`),
+		`package %s is not provided by any required module, run "go get" for it in the plugin module`},
+	{regexp.MustCompile(`requires go >= (\S+?)[ ;]`),
+		`the plugin module requires go %s or newer, use a newer toolchain or lower the go line in go.mod`},
+	{regexp.MustCompile(`C compiler "([^"]+)" not found`),
+		`C compiler %s not found, c-shared plugins need cgo and a C compiler, run builder doctor`},
+	{regexp.MustCompile(`requires external \(cgo\) linking, but cgo is not enabled`),
+		`cgo is disabled (CGO_ENABLED=0), c-shared plugins need cgo and a C compiler, run builder doctor`},
+	{regexp.MustCompile(`inconsistent vendoring`),
+		`vendor/modules.txt does not match go.mod, run "go mod vendor" in the plugin module`},
+	{regexp.MustCompile(`-mod may only be set to readonly or vendor when in workspace mode`),
+		`the plugin is in a go.work workspace, which does not allow -mod=mod: remove -mod=mod from -mod or GOFLAGS, ` +
+			`or build with -env GOWORK=off`},
+	{regexp.MustCompile(`updates to go\.mod needed`),
+		`go.mod needs updates, run "go mod tidy" in the plugin module`},
+	{regexp.MustCompile(`dial tcp|no such host|i/o timeout|connection refused`),
+		`cannot download modules, build offline with -mod=vendor and a vendor directory, ` +
+			`or fill the module cache first with "go mod download"`},
+}
+
+// goCommandError 将go命令的失败转换为错误：能识别的模块与环境问题只给出修复方法（归为环境错误），否则附上go命令的输出
+func goCommandError(name string, err error, output []byte) error {
+	hints := make([]string, 0)
+	seen := make(map[string]bool)
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		for _, h := range goErrorHints {
+			m := h.re.FindStringSubmatch(lines.Text())
+			if m == nil {
+				continue
+			}
+			hint := h.hint
+			if len(m) > 1 {
+				hint = fmt.Sprintf(hint, m[1])
+			}
+			if !seen[hint] {
+				seen[hint] = true
+				hints = append(hints, hint)
+			}
+			break
+		}
+	}
+	if len(hints) == 0 && len(bytes.TrimSpace(output)) == 0 {
+		return fmt.Errorf("%s failed: %v", name, err)
+	}
+	if len(hints) == 0 {
+		return fmt.Errorf("%s failed: %v\n%s", name, err, output)
+	}
+	be := &builderError{Code: exitEnvironment, Err: fmt.Errorf("%s failed: %s", name, strings.Join(hints, "\n"))}
+	for _, hint := range hints {
+		be.Diagnostics = append(be.Diagnostics, &diagnostic{Severity: "error", Code: "environment", Message: hint})
+	}
+	return be
+}
+
+// packageSources 返回目录dir中按当前平台与构建标签tags（与-tags相同，以逗号分隔）的构建约束属于该包的源文件
+// （不包括测试文件与生成的wrappedPlugin.go），goFiles为Go文件，others为C文件、头文件与汇编文件等
+func packageSources(dir, tags string) (goFiles, others []string, err error) {
+	ctxt := build.Default
+	ctxt.BuildTags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+	pkg, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		if name != "wrappedPlugin.go" {
+			goFiles = append(goFiles, name)
+		}
+	}
+	for _, files := range [][]string{pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles, pkg.SysoFiles} {
+		others = append(others, files...)
+	}
+	return goFiles, others, nil
+}
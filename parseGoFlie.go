@@ -8,13 +8,14 @@ import (
 	"go/printer"
 	"go/token"
 	"os"
+	"strconv"
 	"strings"
 )
 
 // Param 参数结构体
 type Param struct {
-	Name string
-	Type string
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
 // 检查参数是否已经存在于切片中（去重）
@@ -81,7 +82,7 @@ func getFuncParams(filename, funcName string) ([]Param, error) {
 	// 遍历 AST 以找到目标函数
 	ast.Inspect(node, func(n ast.Node) bool {
 		if fn, ok := n.(*ast.FuncDecl); ok {
-			if fn.Name.Name == funcName {
+			if fn.Name.Name == funcName && fn.Recv == nil { // 跳过同名方法
 				funcFound = true
 				// 遍历参数列表
 				for _, param := range fn.Type.Params.List {
@@ -102,6 +103,41 @@ func getFuncParams(filename, funcName string) ([]Param, error) {
 	return params, nil
 }
 
+// 在文件的顶层声明中查找函数。recv为空时只匹配普通函数，否则匹配接收者类型为recv或*recv的方法
+func findFuncDecl(file *ast.File, name, recv string) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != name {
+			continue
+		}
+		if recv == "" {
+			if fn.Recv == nil {
+				return fn
+			}
+			continue
+		}
+		if fn.Recv == nil || len(fn.Recv.List) == 0 {
+			continue
+		}
+		if strings.TrimPrefix(exprToString(fn.Recv.List[0].Type), "*") == recv {
+			return fn
+		}
+	}
+	return nil
+}
+
+// 获取函数声明的参数列表
+func getDeclParams(fn *ast.FuncDecl) []Param {
+	var params []Param
+	for _, param := range fn.Type.Params.List {
+		paramType := exprToString(param.Type)
+		for _, paramName := range param.Names {
+			params = append(params, Param{Name: paramName.Name, Type: paramType})
+		}
+	}
+	return params
+}
+
 // 获取函数返回类型
 func getReturnType(fn *ast.FuncDecl) string {
 	// 检查函数是否有返回值
@@ -142,7 +178,7 @@ func getFuncReturnType(filename, funcName string) (string, error) {
 	// 遍历 AST 以找到目标函数
 	ast.Inspect(node, func(n ast.Node) bool {
 		if fn, ok := n.(*ast.FuncDecl); ok {
-			if fn.Name.Name == funcName {
+			if fn.Name.Name == funcName && fn.Recv == nil {
 				// 获取返回类型
 				returnType = getReturnType(fn)
 			}
@@ -231,8 +267,43 @@ func getImports(filename string) ([]string, error) {
 	// 存储 import 语句
 	var imports []string
 	for _, imp := range node.Imports {
+		if imp.Name != nil { // 保留包的别名，如 ft "FuzzGIUPluginBuilder/fuzzTypes"
+			imports = append(imports, imp.Name.Name+" "+imp.Path.Value)
+			continue
+		}
 		imports = append(imports, imp.Path.Value) // 直接使用 imp.Path.Value，保留引号
 	}
 
 	return imports, nil
 }
+
+// 解析插件源文件中的并发控制指令，返回允许同时进入插件函数的调用数，0表示不限制
+//
+//	//fuzzgiu:serial          等价于 //fuzzgiu:concurrency 1
+//	//fuzzgiu:concurrency N   同时最多N个调用
+func getConcurrencyDirective(file *ast.File) (int, error) {
+	concurrency := 0
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			directive := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if !strings.HasPrefix(c.Text, "//fuzzgiu:") {
+				continue
+			}
+			fields := strings.Fields(directive)
+			switch fields[0] {
+			case "fuzzgiu:serial":
+				concurrency = 1
+			case "fuzzgiu:concurrency":
+				if len(fields) != 2 {
+					return 0, fmt.Errorf("bad directive %q, example: //fuzzgiu:concurrency 4", c.Text)
+				}
+				n, err := strconv.Atoi(fields[1])
+				if err != nil || n < 0 {
+					return 0, fmt.Errorf("bad directive %q, concurrency must be a non-negative integer", c.Text)
+				}
+				concurrency = n
+			}
+		}
+	}
+	return concurrency, nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"FuzzGIUPluginBuilder/host"
+)
+
+// reproInputs 可复现构建（-repro）的输入摘要，写入插件元数据的repro字段，builder verify-repro据此重新构建并找出不同的输入。
+// 元数据中的字段由host.ReproInputs定义，使宿主可以读取
+type reproInputs struct {
+	host.ReproInputs
+
+	moduleRoot string // 插件所在模块的根目录，不写入元数据
+}
+
+// reproOptions 重新构建时需要沿用的构建参数
+type reproOptions = host.ReproOptions
+
+// go list -json输出的包信息中用到的字段
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	Module     *struct {
+		Path    string
+		Version string
+		Main    bool
+		Replace *struct {
+			Path    string
+			Version string
+			Dir     string
+		}
+	}
+	GoFiles, CgoFiles, CFiles, HFiles, SFiles, EmbedFiles []string
+}
+
+func shortHash(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// collectReproInputs 计算插件在模块mod的目录dir中以opt构建时的输入摘要。
+// 工作区中只有插件所在模块的副本，因此不支持go.work与指向模块之外的本地replace（以绝对路径replace的fuzzTypes SDK除外，
+// SDK的内容计入FuzzTypes，go.mod中SDK的路径不计入Modules）
+func collectReproInputs(opt *buildOptions, src *pluginSource, dir string, mod *goModule) (*reproInputs, error) {
+	if mod.GoWork != "" {
+		return nil, fmt.Errorf("reproducible builds do not support go.work (%s), build with -env GOWORK=off", mod.GoWork)
+	}
+	env, err := goEnv(opt, dir, "GOVERSION", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64", "GO386",
+		"CGO_ENABLED", "CC", "CGO_CFLAGS", "CGO_CPPFLAGS", "CGO_LDFLAGS", "GOEXPERIMENT")
+	if err != nil {
+		return nil, err
+	}
+	inputs := &reproInputs{
+		ReproInputs: host.ReproInputs{
+			GoVersion: env["GOVERSION"],
+			CC:        ccVersion(opt, dir, env["CC"]),
+			Target:    env["GOOS"] + "/" + env["GOARCH"],
+			Options: reproOptions{Tags: opt.Tags, Strip: opt.Strip, Ldflags: opt.Ldflags,
+				Gcflags: opt.Gcflags, Race: opt.Race, Env: opt.Env, Mod: opt.Mod},
+		},
+		moduleRoot: mod.Root,
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if name != "GOVERSION" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, env[name])
+	}
+	inputs.GoEnv = shortHash(h)
+
+	h = sha256.New()
+	tmplFileName := getTemplateFileName(src.TemplateType, src.Instance)
+	if err = hashFile(h, tmplFileName); err != nil {
+		return nil, err
+	}
+	inputs.Template = shortHash(h)
+
+	h = sha256.New()
+	gomod, err := os.ReadFile(filepath.Join(inputs.moduleRoot, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(h, "file go.mod\n%s", normalizeSDKReplace(gomod))
+	if err = hashFileAs(h, "go.sum", filepath.Join(inputs.moduleRoot, "go.sum")); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	inputs.Modules = shortHash(h)
+
+	// 包装文件引入的包都已被插件引入，插件的依赖即插件文件（包模式为插件所在的包）的依赖。此时包装文件尚未生成
+	target := "./" + filepath.Base(src.Path)
+	if src.Package {
+		target = "."
+	}
+	args := append([]string{"list", "-deps"}, opt.modFlags()...)
+	list := exec.Command(opt.GoPath, append(args, "-json=ImportPath,Dir,Standard,Module,"+
+		"GoFiles,CgoFiles,CFiles,HFiles,SFiles,EmbedFiles", target)...)
+	list.Dir = dir
+	list.Env = opt.buildEnv()
+	stderr := bytes.Buffer{}
+	list.Stderr = &stderr
+	output, err := list.Output()
+	if err != nil {
+		return nil, goCommandError("go list", err, stderr.Bytes())
+	}
+	plugin, fuzzTypes, deps := sha256.New(), sha256.New(), sha256.New()
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for decoder.More() {
+		pkg := new(listedPackage)
+		if err = decoder.Decode(pkg); err != nil {
+			return nil, fmt.Errorf("go list failed: %v", err)
+		}
+		if pkg.Standard {
+			continue
+		}
+		h := plugin
+		switch {
+		case pkg.Module != nil && pkg.Module.Path == fuzzTypesModule:
+			if r := pkg.Module.Replace; r != nil && r.Version == "" && !filepath.IsAbs(r.Path) && !isSubPath(mod.Root, r.Dir) {
+				return nil, fmt.Errorf("reproducible builds need an absolute replace for %s, got %s", fuzzTypesModule, r.Path)
+			}
+			h = fuzzTypes
+			fmt.Fprintf(h, "module %s@%s\n", pkg.Module.Path, pkg.Module.Version)
+		case pkg.Module != nil && !pkg.Module.Main:
+			if r := pkg.Module.Replace; r != nil && r.Version == "" && !isSubPath(mod.Root, r.Dir) {
+				return nil, fmt.Errorf("reproducible builds do not support replace directives to "+
+					"directories outside the plugin module: %s => %s", pkg.Module.Path, r.Path)
+			}
+			h = deps
+			fmt.Fprintf(h, "module %s@%s\n", pkg.Module.Path, pkg.Module.Version)
+		case path.Base(pkg.ImportPath) == "fuzzTypes":
+			h = fuzzTypes
+		}
+		for _, files := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.HFiles, pkg.SFiles, pkg.EmbedFiles} {
+			for _, name := range files {
+				if name == "wrappedPlugin.go" { // 之前使用-keep-intermediate保留下来的包装文件
+					continue
+				}
+				if err = hashFileAs(h, pkg.ImportPath+"/"+name, filepath.Join(pkg.Dir, name)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	inputs.Plugin, inputs.FuzzTypes, inputs.Deps = shortHash(plugin), shortHash(fuzzTypes), shortHash(deps)
+	return inputs, nil
+}
+
+// path是否位于root之中
+func isSubPath(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// C编译器版本，cc可以带参数（如 zig cc），无法获取时为unknown
+func ccVersion(opt *buildOptions, dir, cc string) string {
+	fields := strings.Fields(cc)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	cmd := exec.Command(fields[0], append(fields[1:], "--version")...)
+	cmd.Dir = dir
+	cmd.Env = opt.buildEnv()
+	output, err := cmd.Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+}
+
+// 可复现构建的工作区，位于临时目录下以插件源码摘要命名的固定路径，与源码所在位置无关
+func reproWorkspace(inputs *reproInputs) string {
+	return filepath.Join(os.TempDir(), "fuzzgiu-repro", inputs.Plugin)
+}
+
+// prepareReproWorkspace 将插件所在模块复制到工作区（跳过隐藏目录、builder test的临时目录与构建产物），
+// 返回工作区中对应插件目录dir的路径
+func prepareReproWorkspace(dir string, inputs *reproInputs) (string, error) {
+	rel, err := filepath.Rel(inputs.moduleRoot, dir)
+	if err != nil {
+		return "", err
+	}
+	workspace := reproWorkspace(inputs)
+	if err = os.RemoveAll(workspace); err != nil {
+		return "", err
+	}
+	err = filepath.Walk(inputs.moduleRoot, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		base := info.Name()
+		if info.IsDir() {
+			if name != inputs.moduleRoot && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "fuzzgiuharness")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(base)
+		if !info.Mode().IsRegular() || base == "wrappedPlugin.go" || strings.Contains(base, ".building") ||
+			ext == ".so" || ext == ".dll" || ext == ".dylib" {
+			return nil
+		}
+		target := filepath.Join(workspace, strings.TrimPrefix(name, inputs.moduleRoot))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return copyFile(name, target)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare reproducible workspace: %v", err)
+	}
+	return filepath.Join(workspace, rel), nil
+}
+
+// runVerifyRepro 实现 builder verify-repro source artifact：按artifact元数据中记录的参数以-repro重新构建source，
+// 比较两者的sha256，不一致时列出不同的输入。
+// 退出码：0 一致，1 不一致，2 参数错误，无法完成验证时与构建命令相同（如编译失败为4）
+func runVerifyRepro(args []string) {
+	fs := flag.NewFlagSet("verify-repro", flag.ExitOnError)
+	goPath := fs.String("gopath", "go", "go binary path be used to rebuild the plugin")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder verify-repro [options] pluginPath artifact")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	same, err := verifyRepro(fs.Arg(0), fs.Arg(1), *goPath, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitCode(classify(exitEnvironment, err)))
+	}
+	if !same {
+		os.Exit(exitFailure)
+	}
+}
+
+// verifyRepro 重新构建插件并与artifact比较，结果写入out，返回两者是否一致
+func verifyRepro(source, artifact, goPath string, out io.Writer) (bool, error) {
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		return false, err
+	}
+	meta := findPluginMeta(data)
+	if meta == nil {
+		return false, fmt.Errorf("%s: no plugin metadata found, not a FuzzGIU plugin?", artifact)
+	}
+	if meta.Repro == nil {
+		return false, fmt.Errorf("%s was not built with -repro", artifact)
+	}
+	tmpDir, err := os.MkdirTemp("", "fuzzgiu-verify")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+	recorded := meta.Repro.Options
+	opt := &buildOptions{
+		TemplateType: meta.Type,
+		PluginPath:   source,
+		Output:       filepath.Join(tmpDir, filepath.Base(artifact)),
+		GoPath:       goPath,
+		Concurrency:  meta.Concurrency,
+		Env:          recorded.Env,
+		NoCache:      true,
+		Tags:         recorded.Tags,
+		Strip:        recorded.Strip,
+		Ldflags:      recorded.Ldflags,
+		Gcflags:      recorded.Gcflags,
+		Race:         recorded.Race,
+		Mod:          recorded.Mod,
+		Repro:        true,
+		// 与builder build的默认值相同，fuzzTypes与FuzzGIU不兼容的插件不能通过验证。检查结果不影响构建产物
+		FuzzTypesDrift: "error",
+	}
+	log := bytes.Buffer{}
+	result, err := buildPlugin(opt, &log)
+	if err != nil {
+		return false, fmt.Errorf("rebuild failed: %v\n%s", err, log.String())
+	}
+	rebuilt, err := os.ReadFile(result.Output)
+	if err != nil {
+		return false, err
+	}
+	want, got := sha256.Sum256(data), sha256.Sum256(rebuilt)
+	fmt.Fprintf(out, "artifact sha256 %x\n", want)
+	fmt.Fprintf(out, "rebuilt  sha256 %x\n", got)
+	if want == got {
+		fmt.Fprintf(out, "reproducible: %s was built from %s\n", artifact, source)
+		return true, nil
+	}
+	fmt.Fprintln(out, "NOT reproducible, inputs that differ:")
+	diffs := diffReproInputs(meta.Repro, result.Source.Repro)
+	for _, diff := range diffs {
+		fmt.Fprintf(out, "  %s\n", diff)
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintln(out, "  none recorded, the difference comes from outside the recorded inputs "+
+			"(e.g. a C toolchain that does not build deterministically)")
+	}
+	return false, nil
+}
+
+// 逐项比较两次构建的输入摘要，返回不同的项，格式为 name: artifact值 -> rebuilt值
+func diffReproInputs(artifact, rebuilt *reproInputs) []string {
+	options := func(o reproOptions) string {
+		data, _ := json.Marshal(o)
+		return string(data)
+	}
+	fields := []struct{ name, artifact, rebuilt string }{
+		{"go_version", artifact.GoVersion, rebuilt.GoVersion},
+		{"cc", artifact.CC, rebuilt.CC},
+		{"target", artifact.Target, rebuilt.Target},
+		{"go_env", artifact.GoEnv, rebuilt.GoEnv},
+		{"options", options(artifact.Options), options(rebuilt.Options)},
+		{"template", artifact.Template, rebuilt.Template},
+		{"plugin", artifact.Plugin, rebuilt.Plugin},
+		{"fuzz_types", artifact.FuzzTypes, rebuilt.FuzzTypes},
+		{"deps", artifact.Deps, rebuilt.Deps},
+		{"modules", artifact.Modules, rebuilt.Modules},
+	}
+	diffs := make([]string, 0)
+	for _, f := range fields {
+		if f.artifact != f.rebuilt {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", f.name, f.artifact, f.rebuilt))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,202 @@
+package main
+
+// pluginScaffold gen生成的示例插件：可以直接编译运行的插件函数、调用它的测试代码与对应的用例
+type pluginScaffold struct {
+	Imports  []string          // 插件函数使用的包，fuzzTypes另外添加
+	Function string            // 插件函数
+	Call     string            // plugin_test.go中解码自定义参数并调用插件函数的代码
+	Fixtures map[string]string // testdata下的用例
+	Example  string            // README中对示例的说明
+	Usage    string            // README中在FuzzGIU中使用插件的方法，{name}为插件名
+	// SDK 插件引用fuzzTypes SDK时使用的示例，只替换Imports、Function与Example；为nil时与旧版本的fuzzTypes副本相同
+	SDK *pluginScaffold
+}
+
+// 各插件类型的示例
+var pluginScaffolds = map[string]*pluginScaffold{
+	"payloadProc": {
+		Function: `// PayloadProcessor 在payload前后加上prefix与suffix，如 PayloadProcessor("1", "'", "-- ") 返回 "'1-- "
+func PayloadProcessor(payload string, prefix string, suffix string) string {
+	return prefix + payload + suffix
+}
+`,
+		Call: `var prefix, suffix string
+	fx.arg(t, 0, &prefix)
+	fx.arg(t, 1, &suffix)
+	return PayloadProcessor(fx.Payload, prefix, suffix)`,
+		Fixtures: map[string]string{
+			"quote.json": `{"payload": "1 or 1=1", "args": ["'", "-- "], "expect": "'1 or 1=1-- "}`,
+			"empty.json": `{"payload": "admin", "args": ["", ""], "expect": "admin"}`,
+		},
+		Example: "The example processor wraps every payload in a `prefix` and a `suffix`, " +
+			"e.g. `PayloadProcessor(\"1\", \"'\", \"-- \")` returns `'1-- `.",
+		Usage: "List it in the processors of a payload keyword (`preprocess.pl_temp.<keyword>.processors`), " +
+			"e.g. `\"processors\": \"{name}(',-- )\"`; processors run in the order listed.",
+	},
+	"reactor": {
+		Imports: []string{"fmt", "strings"},
+		Function: `// React 响应中包含keyword时标记为匹配并输出提示，否则不做处理
+func React(request *fuzzTypes.Req, resp *fuzzTypes.Resp, keyword string) *fuzzTypes.Reaction {
+	reaction := new(fuzzTypes.Reaction)
+	if keyword != "" && strings.Contains(string(resp.RawResponse), keyword) {
+		reaction.Flag = fuzzTypes.ReactFlagMatch | fuzzTypes.ReactFlagOutput
+		reaction.Output.Msg = fmt.Sprintf("found %q in the response of %s", keyword, request.URL)
+	}
+	return reaction
+}
+`,
+		Call: `var keyword string
+	fx.arg(t, 0, &keyword)
+	return React(fx.Req, fx.Resp, keyword)`,
+		Fixtures: map[string]string{
+			// raw_response为base64编码，分别为 "welcome, admin" 与 "login failed"
+			"hit.json": `{"req": {"url": "http://127.0.0.1/login"}, "resp": {"raw_response": "d2VsY29tZSwgYWRtaW4="}, ` +
+				`"args": ["admin"], "expect": {"flag": 33, "output": {"msg": "found \"admin\" in the response of http://127.0.0.1/login"}}}`,
+			"miss.json": `{"req": {"url": "http://127.0.0.1/login"}, "resp": {"raw_response": "bG9naW4gZmFpbGVk"}, ` +
+				`"args": ["admin"], "expect": {"flag": 0}}`,
+		},
+		Example: "The example reactor flags a response as a match and prints a message when the response " +
+			"contains `keyword`. To filter and match like the job's `react.filter` and `react.matcher`, " +
+			"use `FuzzGIUPluginBuilder/fuzzTypes/reactSDK`.",
+		Usage: "Set it as the job's reactor (`react.reactors`), e.g. `\"reactors\": \"{name}(admin)\"`.",
+	},
+	"payloadGen": {
+		Imports: []string{"strconv"},
+		Function: `// PayloadGenerator 生成prefix加上从start到end（包括end）的序号，如 PayloadGenerator("user", 1, 3) 返回 user1 user2 user3
+func PayloadGenerator(prefix string, start int, end int) []string {
+	payloads := make([]string, 0)
+	for i := start; i <= end; i++ {
+		payloads = append(payloads, prefix+strconv.Itoa(i))
+	}
+	return payloads
+}
+`,
+		Call: `var prefix string
+	var start, end int
+	fx.arg(t, 0, &prefix)
+	fx.arg(t, 1, &start)
+	fx.arg(t, 2, &end)
+	return PayloadGenerator(prefix, start, end)`,
+		Fixtures: map[string]string{
+			"users.json": `{"args": ["user", 1, 3], "expect": ["user1", "user2", "user3"]}`,
+			"empty.json": `{"args": ["user", 1, 0], "expect": []}`,
+		},
+		Example: "The example generator numbers a prefix, e.g. `PayloadGenerator(\"user\", 1, 3)` returns " +
+			"`user1`, `user2` and `user3`.",
+		Usage: "Use it as the generator of a payload keyword (`preprocess.pl_temp.<keyword>.generators`), " +
+			"e.g. `\"generators\": \"{name}(user,1,100)|plugin\"`.",
+	},
+	"preprocess": {
+		Function: `// Preprocessor 为要发送的请求添加一个请求头，如 Preprocessor(fuzz, "X-Forwarded-For: 127.0.0.1")
+func Preprocessor(fuzz *fuzzTypes.Fuzz, header string) *fuzzTypes.Fuzz {
+	if header != "" {
+		fuzz.Send.Request.HttpSpec.Headers = append(fuzz.Send.Request.HttpSpec.Headers, header)
+	}
+	return fuzz
+}
+`,
+		Call: `var header string
+	fx.arg(t, 0, &header)
+	return Preprocessor(fx.Fuzz, header)`,
+		Fixtures: map[string]string{
+			"header.json": `{"fuzz": {"send": {"request": {"url": "http://127.0.0.1/FUZZ"}}}, ` +
+				`"args": ["X-Forwarded-For: 127.0.0.1"], ` +
+				`"expect": {"send": {"request": {"url": "http://127.0.0.1/FUZZ", "httpSpec": {"headers": ["X-Forwarded-For: 127.0.0.1"]}}}}}`,
+		},
+		Example: "The example preprocessor adds a header to the request of the job, " +
+			"e.g. `Preprocessor(fuzz, \"X-Forwarded-For: 127.0.0.1\")`.",
+		Usage: "List it in the job's preprocessors (`preprocess.preprocessors`), " +
+			"e.g. `\"preprocessors\": \"{name}(X-Forwarded-For: 127.0.0.1)\"`.",
+	},
+	"reqSender": {
+		Imports: []string{"bytes", "io", "net/http", "net/url", "strings", "time"},
+		Function: `// ReqSender 用net/http发送请求，userAgent不为空时设置User-Agent。发送失败时按Retry重试，错误写入ErrMsg
+func ReqSender(sendMeta *fuzzTypes.SendMeta, userAgent string) *fuzzTypes.Resp {
+	resp := new(fuzzTypes.Resp)
+	client := &http.Client{Timeout: time.Duration(sendMeta.Timeout) * time.Second}
+	if !sendMeta.HttpFollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	if sendMeta.Proxy != "" {
+		proxy, err := url.Parse(sendMeta.Proxy)
+		if err != nil {
+			resp.ErrMsg = err.Error()
+			return resp
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+	}
+	request := sendMeta.Request
+	method := request.HttpSpec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	for i := 0; i <= sendMeta.Retry; i++ {
+		req, err := http.NewRequest(method, request.URL, strings.NewReader(request.Data))
+		if err != nil {
+			resp.ErrMsg = err.Error()
+			return resp
+		}
+		for _, header := range request.HttpSpec.Headers {
+			if kv := strings.SplitN(header, ":", 2); len(kv) == 2 {
+				req.Header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+			}
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		start := time.Now()
+		httpResp, err := client.Do(req)
+		if err != nil {
+			resp.ErrMsg = err.Error()
+			continue
+		}
+		body, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			resp.ErrMsg = err.Error()
+			continue
+		}
+		resp.ErrMsg = ""
+		resp.HttpResponse = httpResp
+		resp.ResponseTime = time.Since(start)
+		resp.RawResponse = body
+		resp.Size = len(body)
+		resp.Words = len(bytes.Fields(body))
+		resp.Lines = bytes.Count(body, []byte("\n")) + 1
+		break
+	}
+	return resp
+}
+`,
+		Call: `var userAgent string
+	fx.arg(t, 0, &userAgent)
+	return ReqSender(fx.SendMeta, userAgent)`,
+		Fixtures: map[string]string{
+			// 用例不依赖网络：端口1上没有服务，请求失败，返回空的响应
+			"refused.json": `{"send_meta": {"request": {"url": "http://127.0.0.1:1/"}, "timeout": 2}, ` +
+				`"args": ["FuzzGIU"], "expect": {"size": 0, "raw_response": null}}`,
+		},
+		Example: "The example sender sends the request with `net/http`, honouring the method, headers, body, proxy, " +
+			"timeout, retry and redirect settings of `SendMeta`, and sets `User-Agent` to the custom argument.",
+		Usage: "Select it as the job's request sender, with the custom arguments in parentheses, " +
+			"e.g. `{name}(Mozilla/5.0)`.",
+		SDK: &pluginScaffold{
+			Imports: []string{"FuzzGIUPluginBuilder/fuzzTypes/sendSDK"},
+			Function: `// ReqSender 用sendSDK按SendMeta发送请求，userAgent不为空时设置User-Agent
+func ReqSender(sendMeta *fuzzTypes.SendMeta, userAgent string) *fuzzTypes.Resp {
+	if userAgent == "" || sendMeta.Request == nil {
+		return sendSDK.Send(sendMeta)
+	}
+	// 复制后修改，不影响FuzzGIU传入的请求
+	meta, request := *sendMeta, *sendMeta.Request
+	request.HttpSpec.Headers = append(append([]string(nil), request.HttpSpec.Headers...), "User-Agent: "+userAgent)
+	meta.Request = &request
+	return sendSDK.Send(&meta)
+}
+`,
+			Example: "The example sender sends the request with `FuzzGIUPluginBuilder/fuzzTypes/sendSDK`, which honours " +
+				"every field of `SendMeta` like FuzzGIU does, and sets `User-Agent` to the custom argument. " +
+				"Set the `Prepare`, `Retry` or `Transport` fields of a `sendSDK.Sender` to change how requests are sent.",
+		},
+	},
+}
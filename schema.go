@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"FuzzGIUPluginBuilder/fuzzTypes"
+)
+
+// 可以生成JSON Schema的fuzzTypes结构体，即插件与FuzzGIU之间以JSON传递的类型
+var schemaTypes = map[string]reflect.Type{
+	"Fuzz":        reflect.TypeOf(fuzzTypes.Fuzz{}),
+	"Req":         reflect.TypeOf(fuzzTypes.Req{}),
+	"Resp":        reflect.TypeOf(fuzzTypes.Resp{}),
+	"Reaction":    reflect.TypeOf(fuzzTypes.Reaction{}),
+	"SendMeta":    reflect.TypeOf(fuzzTypes.SendMeta{}),
+	"PayloadTemp": reflect.TypeOf(fuzzTypes.PayloadTemp{}),
+}
+
+// 用例（builder test的fixtures）的Schema名，可以用 fixture.<插件类型> 指定插件类型
+const fixtureSchemaName = "fixture"
+
+// jsonSchema JSON Schema（2020-12）文档，只包含生成fuzzTypes的Schema用到的关键字
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Comment              string                 `json:"$comment,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	Type                 jsonTypes              `json:"type,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false或*jsonSchema
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+}
+
+// JSON Schema中的type，只有一个类型时输出为字符串
+type jsonTypes []string
+
+func (t jsonTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// schemaGen 通过反射结构体的json tag生成Schema，描述取自fuzzTypes.go中的注释。
+// 除根类型外，fuzzTypes中的具名结构体放在$defs中并以$ref引用，引用根类型时为"#"
+type schemaGen struct {
+	root reflect.Type
+	docs map[string]string // Req、Req.HttpSpec.Method形式的类型与字段到注释的映射
+	defs map[string]*jsonSchema
+}
+
+func newSchemaGen(root reflect.Type) *schemaGen {
+	return &schemaGen{root: root, docs: fuzzTypesDocs(), defs: make(map[string]*jsonSchema)}
+}
+
+// fuzzTypesDocs 读取构建器中SDK的fuzzTypes.go中类型与字段的注释，找不到SDK时没有描述
+func fuzzTypesDocs() map[string]string {
+	docs := make(map[string]string)
+	dir, err := sdkDir()
+	if err != nil {
+		return docs
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "fuzzTypes.go"), nil, parser.ParseComments)
+	if err != nil {
+		return docs
+	}
+	add := func(name string, groups ...*ast.CommentGroup) {
+		for _, g := range groups {
+			if text := strings.TrimSpace(g.Text()); text != "" {
+				docs[name] = text
+				return
+			}
+		}
+	}
+	var walk func(prefix string, st *ast.StructType)
+	walk = func(prefix string, st *ast.StructType) {
+		for _, field := range st.Fields.List {
+			for _, name := range field.Names {
+				add(prefix+name.Name, field.Doc, field.Comment)
+				if inner, ok := field.Type.(*ast.StructType); ok {
+					walk(prefix+name.Name+".", inner)
+				}
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.TypeSpec)
+			add(spec.Name.Name, spec.Doc, spec.Comment)
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				walk(spec.Name.Name+".", st)
+			}
+		}
+	}
+	return docs
+}
+
+// document 生成根类型的Schema文档
+func (g *schemaGen) document(title string) *jsonSchema {
+	return g.finish(g.structSchema(g.root, g.root.Name()), title)
+}
+
+// 为根Schema加上$schema、标题与$defs
+func (g *schemaGen) finish(doc *jsonSchema, title string) *jsonSchema {
+	doc.Schema = "https://json-schema.org/draft/2020-12/schema"
+	doc.Comment = "generated by builder schema from fuzzTypes v" + fuzzTypes.SchemaVersion
+	doc.Title = title
+	if len(g.defs) > 0 {
+		doc.Defs = g.defs
+	}
+	return doc
+}
+
+// typeSchema 类型t的Schema，docPath为其在fuzzTypes.go中的注释路径
+func (g *schemaGen) typeSchema(t reflect.Type, docPath string) *jsonSchema {
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return &jsonSchema{Type: jsonTypes{"integer"}, Description: "time.Duration in nanoseconds"}
+	case reflect.TypeOf(json.RawMessage(nil)): // 任意JSON
+		return &jsonSchema{}
+	}
+	zero := 0.0
+	switch t.Kind() {
+	case reflect.Ptr:
+		return &jsonSchema{AnyOf: []*jsonSchema{g.typeSchema(t.Elem(), docPath), {Type: jsonTypes{"null"}}}}
+	case reflect.Struct:
+		if t.Name() != "" && t.PkgPath() == fuzzTypesModule {
+			return g.ref(t)
+		}
+		return g.structSchema(t, docPath)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 { // encoding/json将[]byte编码为base64字符串
+			return &jsonSchema{Type: jsonTypes{"string", "null"}, ContentEncoding: "base64"}
+		}
+		return &jsonSchema{Type: jsonTypes{"array", "null"}, Items: g.typeSchema(t.Elem(), docPath)}
+	case reflect.Map:
+		return &jsonSchema{Type: jsonTypes{"object", "null"}, AdditionalProperties: g.typeSchema(t.Elem(), docPath)}
+	case reflect.String:
+		return &jsonSchema{Type: jsonTypes{"string"}}
+	case reflect.Bool:
+		return &jsonSchema{Type: jsonTypes{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: jsonTypes{"integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &jsonSchema{Type: jsonTypes{"integer"}, Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: jsonTypes{"number"}}
+	}
+	return &jsonSchema{}
+}
+
+// 引用fuzzTypes中的具名结构体，第一次引用时生成其定义
+func (g *schemaGen) ref(t reflect.Type) *jsonSchema {
+	if t == g.root {
+		return &jsonSchema{Ref: "#"}
+	}
+	if _, ok := g.defs[t.Name()]; !ok {
+		g.defs[t.Name()] = nil // 先占位，结构体引用自身时不再重复生成
+		g.defs[t.Name()] = g.structSchema(t, t.Name())
+	}
+	return &jsonSchema{Ref: "#/$defs/" + t.Name()}
+}
+
+// 结构体的Schema：字段按json tag命名，不允许未知的字段（FuzzGIU会忽略它们，多为拼写错误）
+func (g *schemaGen) structSchema(t reflect.Type, docPath string) *jsonSchema {
+	s := &jsonSchema{Type: jsonTypes{"object"}, Description: g.docs[docPath],
+		Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // 未导出
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldPath := docPath + "." + field.Name
+		prop := g.typeSchema(field.Type, fieldPath)
+		if prop.Description == "" {
+			prop.Description = g.docs[fieldPath]
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+// fixtureSchema builder test用例的Schema。插件类型templateType为空时输入字段与expect不限于某种插件
+func fixtureSchema(templateType string) (*jsonSchema, error) {
+	g := newSchemaGen(reflect.TypeOf(callInput{}))
+	title := "builder test fixture"
+	var doc *jsonSchema
+	if templateType == "" {
+		doc = g.structSchema(g.root, "")
+		doc.Properties["expect"] = &jsonSchema{}
+	} else {
+		p := abi.plugin(templateType)
+		if p == nil {
+			return nil, fmt.Errorf("unknown template type %s", templateType)
+		}
+		title += " for " + templateType + " plugins"
+		arguments := reflect.TypeOf([]json.RawMessage(nil))
+		doc = &jsonSchema{Type: jsonTypes{"object"}, AdditionalProperties: false, Properties: map[string]*jsonSchema{
+			"args":      g.typeSchema(arguments, ""),
+			"ctor_args": g.typeSchema(arguments, ""),
+			"expect":    g.abiTypeSchema(p.Result.Type),
+		}}
+		for _, in := range p.Inputs {
+			doc.Properties[in.Name] = g.abiTypeSchema(in.Type)
+		}
+	}
+	doc.Properties["args"].Description = "custom arguments after the fixed parameters, in the order they are declared"
+	doc.Properties["ctor_args"].Description = "constructor arguments of instance mode plugins"
+	doc.Properties["expect"].Description = "expected plugin output, objects only compare the fields listed"
+	return g.finish(doc, title), nil
+}
+
+// templates/abi.json中参数与返回值类型的Schema，如 *fuzzTypes.Req 与 []string
+func (g *schemaGen) abiTypeSchema(goType string) *jsonSchema {
+	if name := strings.TrimPrefix(goType, "*fuzzTypes."); name != goType {
+		if t, ok := schemaTypes[name]; ok {
+			return g.typeSchema(reflect.PtrTo(t), name)
+		}
+	}
+	switch goType {
+	case "string":
+		return g.typeSchema(reflect.TypeOf(""), "")
+	case "[]string":
+		return g.typeSchema(reflect.TypeOf([]string(nil)), "")
+	}
+	return &jsonSchema{}
+}
+
+// schemaFor 按名称生成Schema：fuzzTypes中的结构体名（job为Fuzz的别名，不区分大小写），
+// 或fixture、fixture.<插件类型>
+func schemaFor(name string) (*jsonSchema, error) {
+	if strings.EqualFold(name, fixtureSchemaName) {
+		return fixtureSchema("")
+	}
+	if strings.HasPrefix(name, fixtureSchemaName+".") {
+		return fixtureSchema(strings.TrimPrefix(name, fixtureSchemaName+"."))
+	}
+	if strings.EqualFold(name, "job") {
+		name = "Fuzz"
+	}
+	for typeName, t := range schemaTypes {
+		if strings.EqualFold(name, typeName) {
+			return newSchemaGen(t).document("fuzzTypes." + typeName), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown schema %s, use one of %s", name, strings.Join(schemaNames(), ", "))
+}
+
+// 全部Schema的名称：fuzzTypes中的结构体、通用的用例与各插件类型的用例
+func schemaNames() []string {
+	names := make([]string, 0, len(schemaTypes)+1+len(abi.Plugins))
+	for name := range schemaTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append(names, fixtureSchemaName)
+	for _, p := range abi.Plugins {
+		names = append(names, fixtureSchemaName+"."+p.Type)
+	}
+	return names
+}
+
+// runSchema 实现 builder schema [-o dir] [name...]：生成fuzzTypes结构体与builder test用例的JSON Schema。
+// 指定-o时将各Schema写入dir下的<name>.schema.json（未指定名称时为全部），否则将一个Schema输出到标准输出
+func runSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	outDir := fs.String("o", "", "directory to write <name>.schema.json files to, all schemas if no name is given")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: builder schema name\n       builder schema -o dir [name...]\n"+
+			"names: %s (job is an alias of Fuzz)\n", strings.Join(schemaNames(), ", "))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	names := fs.Args()
+	if *outDir == "" && len(names) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(names) == 0 {
+		names = schemaNames()
+	}
+	for _, name := range names {
+		schema, err := schemaFor(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		data, _ := json.MarshalIndent(schema, "", "  ")
+		data = append(data, '\n')
+		if *outDir == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err = os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		file := filepath.Join(*outDir, name+".schema.json")
+		if err = os.WriteFile(file, data, 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created %s\n", file)
+	}
+}
+
+// runValidateJson 实现 builder validate-json [-t type] name file...：按Schema检查任务文件与用例。
+// name为fixture时插件类型取自-t，或用例所在testdata目录的上级目录（插件目录）中fuzzgiu.json的type。
+// 退出码：0 通过，1 文件不符合Schema，2 无法完成检查（如文件不存在）
+func runValidateJson(args []string) {
+	fs := flag.NewFlagSet("validate-json", flag.ExitOnError)
+	templateType := fs.String("t", "", "template type of fixtures, defaults to \"type\" in "+buildConfigName+
+		" in the plugin directory above testdata")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: builder validate-json [-t type] name file...\nnames: %s (job is an alias of Fuzz)\n",
+			strings.Join(schemaNames(), ", "))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name, invalid := fs.Arg(0), 0
+	for _, file := range fs.Args()[1:] {
+		schemaName := name
+		if strings.EqualFold(name, fixtureSchemaName) {
+			tt := *templateType
+			if tt == "" {
+				tt = configTemplateType(filepath.Dir(filepath.Dir(file)))
+			}
+			if tt != "" {
+				schemaName = fixtureSchemaName + "." + tt
+			}
+		}
+		schema, err := schemaFor(schemaName)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		problems, err := validateJsonFile(schema, file)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("ok   %s\n", file)
+			continue
+		}
+		invalid++
+		fmt.Printf("FAIL %s\n", file)
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// 按schema检查JSON文件，返回发现的问题
+func validateJsonFile(schema *jsonSchema, file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // 区分整数与小数
+	var v interface{}
+	if err = decoder.Decode(&v); err != nil {
+		return []string{"invalid JSON: " + err.Error()}, nil
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return []string{"invalid JSON: extra data after the top-level value"}, nil
+	}
+	problems := make([]string, 0)
+	schema.validate(schema, v, "", &problems)
+	return problems, nil
+}
+
+// validate 检查v是否符合s，ptr为v的JSON Pointer，问题追加到problems中。
+// 只支持jsonSchema中的关键字；anyOf只用于可以为null的类型，v不为null时按第一个分支检查
+func (s *jsonSchema) validate(root *jsonSchema, v interface{}, ptr string, problems *[]string) {
+	at := ptr
+	if at == "" {
+		at = "/"
+	}
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, at+": "+fmt.Sprintf(format, args...))
+	}
+	if s.Ref != "" {
+		target := root
+		if s.Ref != "#" {
+			target = root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+		}
+		if target != nil {
+			target.validate(root, v, ptr, problems)
+		}
+		return
+	}
+	if len(s.AnyOf) > 0 {
+		for _, branch := range s.AnyOf {
+			if v == nil && branch.allows("null") {
+				return
+			}
+		}
+		s.AnyOf[0].validate(root, v, ptr, problems)
+		return
+	}
+	actual := jsonValueType(v)
+	if len(s.Type) > 0 && !s.allows(actual) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), actual)
+		return
+	}
+	switch v := v.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil && s.Minimum != nil && f < *s.Minimum {
+			report("%s is less than the minimum %v", v, *s.Minimum)
+		}
+	case string:
+		if s.ContentEncoding == "base64" {
+			if _, err := base64.StdEncoding.DecodeString(v); err != nil {
+				report("not valid base64: %v", err)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(root, item, ptr+"/"+strconv.Itoa(i), problems)
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := ptr + "/" + strings.Replace(strings.Replace(k, "~", "~0", -1), "/", "~1", -1)
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(root, v[k], child, problems)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *jsonSchema:
+				additional.validate(root, v[k], child, problems)
+			case bool:
+				if additional {
+					continue
+				}
+				problem := fmt.Sprintf("unknown field %q, FuzzGIU ignores it", k)
+				for name := range s.Properties {
+					if strings.EqualFold(name, k) { // encoding/json不区分大小写，但其他语言的工具通常区分
+						problem = fmt.Sprintf("field %q only matches %q ignoring case, use %q", k, name, name)
+					}
+				}
+				report("%s", problem)
+			}
+		}
+	}
+}
+
+// Schema的type是否允许typ，integer也是number
+func (s *jsonSchema) allows(typ string) bool {
+	for _, t := range s.Type {
+		if t == typ || t == "number" && typ == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON值的类型，不带小数与指数的数为integer
+func jsonValueType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fuzzTypes SDK的模块路径。SDK位于构建器源码目录下的fuzzTypes中，生成的插件以require加指向该目录的本地replace引用，
+// 不需要联网，require中的版本为SDK的SchemaVersion
+const fuzzTypesModule = "FuzzGIUPluginBuilder/fuzzTypes"
+
+// 构建器中fuzzTypes SDK目录的绝对路径，与templates一样按当前目录查找
+func sdkDir() (string, error) {
+	dir, err := filepath.Abs("fuzzTypes")
+	if err != nil {
+		return "", err
+	}
+	if isFile, err := IsFile(filepath.Join(dir, "go.mod")); err != nil || !isFile {
+		return "", fmt.Errorf("fuzzTypes SDK not found in %s, run the builder from its source directory", dir)
+	}
+	return dir, nil
+}
+
+// schemaVersion 读取目录dir中fuzzTypes包的SchemaVersion常量，没有时（如旧版本复制的fuzzTypes.go）返回空串
+func schemaVersion(dir string) (string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					spec := spec.(*ast.ValueSpec)
+					for i, name := range spec.Names {
+						if name.Name != "SchemaVersion" || i >= len(spec.Values) {
+							continue
+						}
+						if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							return strconv.Unquote(lit.Value)
+						}
+					}
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// go.mod中引用SDK的require与replace
+func sdkDirectives(version, dir string) string {
+	return fmt.Sprintf("require %s v%s\n\nreplace %s => %s\n", fuzzTypesModule, version, fuzzTypesModule, dir)
+}
+
+// go.mod是否require了SDK
+func requiresSDK(mod []byte) bool {
+	return regexp.MustCompile(`(?m)^\s*(require\s+)?` + regexp.QuoteMeta(fuzzTypesModule) + `\s+v`).Match(mod)
+}
+
+// 以go mod edit在dir所在模块的go.mod中require SDK的version版本，并replace到SDK目录sdk
+func requireSDK(toolchain *goToolchain, dir, version, sdk string) error {
+	edit := exec.Command(toolchain.Path, "mod", "edit",
+		"-require="+fuzzTypesModule+"@v"+version, "-replace="+fuzzTypesModule+"="+sdk)
+	edit.Dir = dir
+	if output, err := edit.CombinedOutput(); err != nil {
+		return goCommandError("go mod edit", err, output)
+	}
+	return nil
+}
+
+// 将go.mod中SDK的replace目标替换为固定的名称，使可复现构建的摘要与SDK所在位置无关
+var sdkReplaceRe = regexp.MustCompile(`(?m)^(\s*(?:replace\s+)?` + regexp.QuoteMeta(fuzzTypesModule) + `(?:\s+v\S+)?\s+=>\s+)\S+.*$`)
+
+func normalizeSDKReplace(mod []byte) []byte {
+	return sdkReplaceRe.ReplaceAll(mod, []byte("${1}fuzzTypes"))
+}
+
+// fuzzTypesVersion 插件引用的fuzzTypes包的SchemaVersion，写入插件元数据。插件没有引用fuzzTypes，
+// 或引用的是旧版本复制到插件中的fuzzTypes.go时返回空串
+func fuzzTypesVersion(opt *buildOptions, dir string, src *pluginSource) (string, error) {
+	imports := fuzzTypesImports(src)
+	if len(imports) == 0 {
+		return "", nil
+	}
+	args := append([]string{"list"}, opt.modFlags()...)
+	list := exec.Command(opt.GoPath, append(append(args, "-f", "{{.Dir}}"), imports...)...)
+	list.Dir = dir
+	list.Env = opt.buildEnv()
+	stderr := bytes.Buffer{}
+	list.Stderr = &stderr
+	output, err := list.Output()
+	if err != nil {
+		return "", goCommandError("go list", err, stderr.Bytes())
+	}
+	return schemaVersion(strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]))
+}
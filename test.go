@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// testOptions builder test 的参数
+type testOptions struct {
+	TemplateType     string
+	PluginPath       string // 插件文件或目录
+	FixturesDir      string // 用例目录，为空时使用插件目录下的testdata
+	GoPath           string
+	Env              []string // 追加到go test环境变量中
+	Tags             string   // 传给go test的-tags
+	Mod              string   // 传给go test的-mod
+	KeepIntermediate bool
+	Verbose          bool // 是否输出通过的用例的插件输出
+}
+
+// 插件调用的期望结果，包含在用例文件中
+type fixtureExpect struct {
+	Expect json.RawMessage `json:"expect"`
+}
+
+// 测试程序输出的单个用例运行结果，与harness.gotmp中的harnessResult对应
+type fixtureResult struct {
+	Name   string          `json:"name"`
+	Output json.RawMessage `json:"output"`
+	Error  string          `json:"error"`
+}
+
+// runTest 实现 builder test -t reactor [-fixtures dir] pluginDir
+// 用例为fixtures目录下的*.json文件，按插件类型填写输入字段，expect为期望的输出（可省略）：
+//
+//	reactor     {"req": Req, "resp": Resp, "expect": Reaction}
+//	preprocess  {"fuzz": Fuzz, "expect": Fuzz}
+//	payloadProc {"payload": "...", "expect": "..."}
+//	payloadGen  {"expect": ["...", ...]}
+//	reqSender   {"send_meta": SendMeta, "expect": Resp}
+//
+// 自定义参数通过 "args": [...] 传入，实例模式下构造函数参数通过 "ctor_args": [...] 传入。
+// expect为对象时只比较其中出现的字段
+func runTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	opt := &testOptions{}
+	fs.StringVar(&opt.TemplateType, "t", "", "template type, can be "+
+		"payloadProc,reactor,payloadGen,reqSender or preprocess. "+
+		"defaults to \"type\" in "+buildConfigName+" in the plugin directory")
+	fs.StringVar(&opt.FixturesDir, "fixtures", "", "fixtures directory, "+
+		"defaults to testdata in the plugin directory")
+	fs.StringVar(&opt.GoPath, "gopath", "go", "go binary path be used to build the test harness, "+
+		"a comma-separated list runs the fixtures with each toolchain")
+	fs.BoolVar(&opt.KeepIntermediate, "keep-intermediate", false, "keep intermediate files")
+	fs.BoolVar(&opt.Verbose, "v", false, "print plugin output of passed fixtures")
+	fs.StringVar(&opt.Tags, "tags", "", "comma-separated build tags passed to go test, "+
+		"defaults to \"tags\" in "+buildConfigName+" in the plugin directory")
+	fs.StringVar(&opt.Mod, "mod", "", "module download mode passed to go test: readonly, vendor or mod, "+
+		"defaults to \"mod\" in "+buildConfigName+" in the plugin directory")
+	cliEnv := make([]string, 0)
+	fs.Var(envFlag{&cliEnv}, "env", "KEY=VALUE environment variable for go test, may be repeated, "+
+		"added after \"env\" in "+buildConfigName)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder test -t type [options] pluginPath")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 1 && opt.TemplateType == "" {
+		opt.TemplateType = configTemplateType(fs.Arg(0))
+	}
+	if fs.NArg() != 1 || opt.TemplateType == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	opt.PluginPath = fs.Arg(0)
+	// 与builder build一样使用构建配置中的tags、mod与env，再次解析命令行使显式指定的参数优先
+	conf := &buildOptions{}
+	pluginBuildConfig(opt.PluginPath).apply(conf)
+	opt.Tags, opt.Mod, opt.Env = conf.Tags, conf.Mod, conf.Env
+	cliEnv = cliEnv[:0]
+	fs.Parse(args)
+	opt.Env = append(opt.Env, cliEnv...)
+	toolchains := splitToolchains(opt.GoPath)
+	if len(toolchains) == 1 {
+		_, failed, err := testPlugin(opt, os.Stdout)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitCode(err))
+		}
+		if failed > 0 {
+			os.Exit(exitFailure)
+		}
+		return
+	}
+	// 依次用每个工具链运行用例，GOTOOLCHAIN=local使go命令不切换工具链
+	passed := 0
+	for _, goPath := range toolchains {
+		fmt.Printf("== %s\n", goPath)
+		tcOpt := *opt
+		tcOpt.GoPath, tcOpt.Env = goPath, append(append([]string(nil), opt.Env...), "GOTOOLCHAIN=local")
+		_, failed, err := testPlugin(&tcOpt, os.Stdout)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if failed == 0 {
+			passed++
+		}
+	}
+	fmt.Printf("%d of %d toolchains passed\n", passed, len(toolchains))
+	if passed != len(toolchains) {
+		os.Exit(exitFailure)
+	}
+}
+
+// 运行go list与go test时使用的构建参数
+func (opt *testOptions) buildOptions() *buildOptions {
+	return &buildOptions{GoPath: opt.GoPath, Env: opt.Env, Tags: opt.Tags, Mod: opt.Mod}
+}
+
+// testPlugin 将插件与包装文件编译进Go测试程序，通过包装函数对每个用例调用插件，并与期望结果比较。返回通过与失败的用例数
+func testPlugin(opt *testOptions, out io.Writer) (passed, failed int, err error) {
+	pluginPath := opt.PluginPath
+	isFile, err := IsFile(pluginPath)
+	if err != nil {
+		return 0, 0, classify(exitUsage, err)
+	}
+	if !isFile { // 如果路径是目录，则采用目录下的plugin.go文件
+		pluginPath = filepath.Join(pluginPath, "plugin.go")
+	}
+	src, err := parsePlugin(pluginPath, opt.TemplateType)
+	if err != nil {
+		return 0, 0, classify(exitSignature, err)
+	}
+	src.Package = !isFile
+	pluginDir, err := filepath.Abs(filepath.Dir(pluginPath))
+	if err != nil {
+		return 0, 0, err
+	}
+	goOpt := opt.buildOptions()
+	resolveImportNames(opt.GoPath, pluginDir, goOpt.buildEnv(), goOpt.modFlags(), src)
+	wrapped, err := wrapPlugin(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	harness, err := genHarness(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	fixturesDir := opt.FixturesDir
+	if fixturesDir == "" {
+		fixturesDir = filepath.Join(pluginDir, "testdata")
+	}
+	if fixturesDir, err = filepath.Abs(fixturesDir); err != nil {
+		return 0, 0, err
+	}
+	// 测试程序需要位于插件所在的模块中，才能解析插件的import
+	harnessDir, err := os.MkdirTemp(pluginDir, "fuzzgiuharness")
+	if err != nil {
+		return 0, 0, err
+	}
+	if !opt.KeepIntermediate {
+		defer os.RemoveAll(harnessDir)
+	}
+	if src.Package { // 包模式的包装文件不内联插件源码，复制插件所在包的源文件
+		goFiles, others, err := packageSources(pluginDir, opt.Tags)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, name := range append(goFiles, others...) {
+			if err = copyFile(filepath.Join(pluginDir, name), filepath.Join(harnessDir, name)); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if err = os.WriteFile(filepath.Join(harnessDir, "wrappedPlugin.go"), wrapped, 0644); err != nil {
+		return 0, 0, err
+	}
+	if err = os.WriteFile(filepath.Join(harnessDir, "fuzzgiu_harness_test.go"), harness, 0644); err != nil {
+		return 0, 0, err
+	}
+	resultsFile := filepath.Join(harnessDir, "results.json")
+	testArgs := append([]string{"test", "-count=1"}, goOpt.modFlags()...)
+	if opt.Tags != "" {
+		testArgs = append(testArgs, "-tags", opt.Tags)
+	}
+	cmd := exec.Command(opt.GoPath, append(testArgs, "-run", "^TestFuzzGIUFixtures$", ".")...)
+	cmd.Dir = harnessDir
+	cmd.Env = append(goOpt.buildEnv(), "FUZZGIU_FIXTURES="+fixturesDir, "FUZZGIU_RESULTS="+resultsFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return 0, 0, fmt.Errorf("failed to run test harness: %v\n%s", err, output)
+	}
+	resultsJson, err := os.ReadFile(resultsFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	var results []fixtureResult
+	if err = json.Unmarshal(resultsJson, &results); err != nil {
+		return 0, 0, err
+	}
+	if len(results) == 0 {
+		return 0, 0, fmt.Errorf("no fixtures found in %s", fixturesDir)
+	}
+	for _, result := range results {
+		ok, detail := checkFixture(filepath.Join(fixturesDir, result.Name), &result)
+		if ok {
+			fmt.Fprintf(out, "PASS %s\n", result.Name)
+			if opt.Verbose {
+				fmt.Fprintf(out, "%s\n", indentJson(result.Output))
+			}
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "FAIL %s\n%s", result.Name, detail)
+	}
+	passed = len(results) - failed
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failed)
+	return passed, failed, nil
+}
+
+// 检查单个用例的运行结果，不通过时返回的detail中包含错误信息或期望结果(-)与实际输出(+)的差异
+func checkFixture(fixtureFile string, result *fixtureResult) (bool, string) {
+	if result.Error != "" {
+		return false, "  " + result.Error + "\n"
+	}
+	data, err := os.ReadFile(fixtureFile)
+	if err != nil {
+		return false, "  " + err.Error() + "\n"
+	}
+	fx := new(fixtureExpect)
+	if err = json.Unmarshal(data, fx); err != nil {
+		return false, "  " + err.Error() + "\n"
+	}
+	if len(fx.Expect) == 0 { // 没有期望结果，插件正常返回即通过
+		return true, ""
+	}
+	var expect, actual interface{}
+	if err = json.Unmarshal(fx.Expect, &expect); err != nil {
+		return false, "  bad expect: " + err.Error() + "\n"
+	}
+	if err = json.Unmarshal(result.Output, &actual); err != nil {
+		return false, "  bad plugin output: " + err.Error() + "\n"
+	}
+	expectJson, _ := json.MarshalIndent(expect, "", "  ")
+	actualJson, _ := json.MarshalIndent(pruneLike(actual, expect), "", "  ")
+	if bytes.Equal(expectJson, actualJson) {
+		return true, ""
+	}
+	return false, lineDiff(string(expectJson), string(actualJson))
+}
+
+// 按照expect的结构裁剪actual：对象只保留expect中出现的字段，使期望结果可以只写关心的字段
+func pruneLike(actual, expect interface{}) interface{} {
+	switch e := expect.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return actual
+		}
+		pruned := make(map[string]interface{})
+		for k, v := range e {
+			if av, ok := a[k]; ok {
+				pruned[k] = pruneLike(av, v)
+			}
+		}
+		return pruned
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return actual
+		}
+		pruned := make([]interface{}, len(a))
+		for i := range a {
+			pruned[i] = pruneLike(a[i], e[i])
+		}
+		return pruned
+	}
+	return actual
+}
+
+func indentJson(raw json.RawMessage) string {
+	buf := bytes.Buffer{}
+	if err := json.Indent(&buf, raw, "  ", "  "); err != nil {
+		return "  " + string(raw)
+	}
+	return "  " + buf.String()
+}
+
+// genHarness 根据插件类型生成测试程序，测试程序与包装文件位于同一个包中，通过包装函数调用插件
+func genHarness(src *pluginSource) ([]byte, error) {
+	tmpl, err := os.ReadFile("templates/harness.gotmp")
+	if err != nil {
+		return nil, err
+	}
+	decode := ""
+	// 将用例中的参数解码为插件声明的类型
+	declareArgs := func(params []Param, field, prefix string) []string {
+		names := make([]string, 0, len(params))
+		for i, param := range params {
+			name := fmt.Sprintf("%s%d", prefix, i)
+			decode += fmt.Sprintf("var %s %s\n\tif err = harnessArg(fx.%s, %d, &%s); err != nil {\n"+
+				"\t\treturn nil, err\n\t}\n\t", name, param.Type, field, i, name)
+			names = append(names, name)
+		}
+		return names
+	}
+	ctorArgs := declareArgs(src.CtorParams, "CtorArgs", "ctorArg")
+	callArgs := declareArgs(src.Params, "Args", "arg")
+	p := abi.plugin(src.TemplateType)
+	if p == nil {
+		return nil, errors.New("unsupported template type: " + src.TemplateType)
+	}
+	call, wrapper := "", abi.Exports.Wrapper
+	var fixedArgs []string
+	if src.Instance {
+		call = fmt.Sprintf("handle := %s(%s)\n\tdefer %s(handle)\n\t",
+			abi.Exports.NewInstance, strings.Join(ctorArgs, ", "), abi.Exports.FreeInstance)
+		wrapper = abi.Exports.Call
+		fixedArgs = append(fixedArgs, "handle")
+	}
+	// 固定参数与返回值按templates/abi.json中的编码传递，用例中的字段名为首字母大写的参数名
+	for _, in := range p.Inputs {
+		field := "fx." + exported(in.Name)
+		switch in.Encoding {
+		case "json":
+			call += fmt.Sprintf("%s := harnessInput(%s)\n\t", in.Name, field)
+			fixedArgs = append(fixedArgs, "&"+in.Name+"[0]", "len("+in.Name+")")
+		case "string":
+			fixedArgs = append(fixedArgs, field)
+		}
+	}
+	decodeOutput := map[string]string{
+		"json":       "harnessLenPrefixed",
+		"string":     "harnessString",
+		"stringList": "harnessStringList",
+	}[p.Result.Encoding]
+	call += fmt.Sprintf("return %s(%s(%s))", decodeOutput, wrapper,
+		strings.Join(append(fixedArgs, callArgs...), ", "))
+	tmpl = bytes.Replace(tmpl, []byte("/* DECODE ARGUMENTS */"), []byte(strings.TrimSpace(decode)), -1)
+	tmpl = bytes.Replace(tmpl, []byte("/* CALL PLUGIN */"), []byte(call), -1)
+	tmpl = bytes.Replace(tmpl, []byte("/* CUSTOM IMPORTS */"),
+		[]byte(getParamImports(src.Imports, src.ImportNames, append(src.Params, src.CtorParams...))), -1)
+	return tmpl, nil
+}
+
+// 返回参数类型中引用到的包对应的import语句，包名为import的别名或go list解析出的包名
+func getParamImports(imports []string, names map[string]string, params []Param) string {
+	ret := ""
+	for _, imp := range imports {
+		for _, param := range params {
+			if usesPackage([]byte(param.Type), importName(imp, names)) {
+				ret += fmt.Sprintf("import %s\n", imp)
+				break
+			}
+		}
+	}
+	return ret
+}
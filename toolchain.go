@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// goToolchain go env给出的工具链信息
+type goToolchain struct {
+	Path       string // go命令
+	Version    string // GOVERSION，如 go1.22.3、go1.23rc1 或 devel go1.24-a1b2c3d ...
+	GOOS       string
+	GOARCH     string
+	CGOEnabled bool
+	CC         string
+}
+
+// GOVERSION中的Go版本号，第一个分组为次版本号
+var goVersionRe = regexp.MustCompile(`go1\.(\d+)(\.\d+|rc\d+|beta\d+)?`)
+
+// detectToolchain 以环境变量env运行goPath env -json，读取工具链的版本与目标平台
+func detectToolchain(goPath string, env []string) (*goToolchain, error) {
+	values, err := goEnv(&buildOptions{GoPath: goPath, Env: env}, "",
+		"GOVERSION", "GOOS", "GOARCH", "CGO_ENABLED", "CC")
+	if err != nil {
+		return nil, fmt.Errorf("go toolchain %s is not usable: %v", goPath, err)
+	}
+	return &goToolchain{
+		Path:       goPath,
+		Version:    values["GOVERSION"],
+		GOOS:       values["GOOS"],
+		GOARCH:     values["GOARCH"],
+		CGOEnabled: values["CGO_ENABLED"] == "1",
+		CC:         values["CC"],
+	}, nil
+}
+
+// 是否为正式发布的版本（包括rc与beta），devel版本不能用作toolchain指令
+func (tc *goToolchain) isRelease() bool {
+	return strings.HasPrefix(tc.Version, "go1.")
+}
+
+// 用于文件名的短版本号，如 go1.22.3、go1.24-devel
+func (tc *goToolchain) shortVersion() string {
+	m := goVersionRe.FindString(tc.Version)
+	switch {
+	case m == "":
+		return "unknown"
+	case !tc.isRelease():
+		return m + "-devel"
+	}
+	return m
+}
+
+// modDirectives 返回生成的go.mod中的go与toolchain指令。go指令只写语言版本（如 go 1.22），
+// 使更早的补丁版本也能构建插件；Go 1.21起另写toolchain指令记录生成时使用的工具链，devel版本不写
+func (tc *goToolchain) modDirectives() (goLine, toolchainLine string, err error) {
+	m := goVersionRe.FindStringSubmatch(tc.Version)
+	if m == nil {
+		return "", "", fmt.Errorf("cannot parse go version %q", tc.Version)
+	}
+	minor, _ := strconv.Atoi(m[1])
+	goLine = "go 1." + m[1]
+	if minor >= 21 && tc.isRelease() {
+		toolchainLine = "toolchain " + m[0]
+	}
+	return goLine, toolchainLine, nil
+}
+
+// 按逗号拆分-gopath指定的工具链列表
+func splitToolchains(goPath string) []string {
+	toolchains := make([]string, 0)
+	for _, p := range strings.Split(goPath, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			toolchains = append(toolchains, p)
+		}
+	}
+	return toolchains
+}
+
+// buildMatrix 依次用每个工具链构建插件，testOpt不为nil时构建成功后运行用例，检查插件与各个Go版本的兼容性。
+// 设置GOTOOLCHAIN=local，使go命令不会按go.mod切换到其他工具链；输出文件名中追加版本号，如 FuzzGIUReact_go1.22.3.dll。
+// 有工具链失败时返回的错误取各失败中最大的退出码
+func buildMatrix(opt *buildOptions, testOpt *testOptions, toolchains []string, out io.Writer) error {
+	passed, code := 0, 0
+	fail := func(c int) {
+		if c > code {
+			code = c
+		}
+	}
+	for _, goPath := range toolchains {
+		env := append(append([]string(nil), opt.Env...), "GOTOOLCHAIN=local")
+		tc, err := detectToolchain(goPath, env)
+		if err != nil {
+			fmt.Fprintf(out, "== %s\nFAIL %v\n", goPath, err)
+			fail(exitEnvironment)
+			continue
+		}
+		fmt.Fprintf(out, "== %s (%s, %s/%s)\n", tc.Version, goPath, tc.GOOS, tc.GOARCH)
+		if !tc.CGOEnabled {
+			fmt.Fprintf(out, "FAIL cgo is disabled (CGO_ENABLED=0), c-shared plugins need cgo and a C compiler\n")
+			fail(exitEnvironment)
+			continue
+		}
+		tcOpt := *opt
+		tcOpt.GoPath, tcOpt.Env = goPath, env
+		ext := filepath.Ext(opt.outputName())
+		tcOpt.Output = strings.TrimSuffix(opt.outputName(), ext) + "_" + tc.shortVersion() + ext
+		var tcTestOpt *testOptions
+		if testOpt != nil {
+			t := *testOpt
+			t.GoPath, t.Env = goPath, env
+			tcTestOpt = &t
+		}
+		if err = buildCycle(&tcOpt, tcTestOpt, out); err != nil {
+			fail(exitCode(err))
+			continue
+		}
+		passed++
+	}
+	fmt.Fprintf(out, "%d of %d toolchains passed\n", passed, len(toolchains))
+	if passed == len(toolchains) {
+		return nil
+	}
+	return &builderError{Code: code, Err: fmt.Errorf("%d of %d toolchains failed", len(toolchains)-passed, len(toolchains))}
+}
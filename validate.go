@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runValidate 实现 builder validate -t type pluginPath：检查插件签名，在内存中生成包装文件并用go/types做类型检查。
+// import的包使用go list -export编译出的导出数据，不调用cgo与链接器，适合在保存文件时或提交前运行。
+// 退出码：0 通过，3 插件有问题，2 参数错误或插件文件不存在，5 无法完成检查（如模板缺失）
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	templateType := fs.String("t", "", "template type, can be "+
+		"payloadProc,reactor,payloadGen,reqSender or preprocess. "+
+		"defaults to \"type\" in "+buildConfigName+" in the plugin directory")
+	goPath := fs.String("gopath", "go", "go binary path be used to load imported packages")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: builder validate -t type [options] pluginPath")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 1 && *templateType == "" {
+		*templateType = configTemplateType(fs.Arg(0))
+	}
+	if fs.NArg() != 1 || *templateType == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	problems, err := validatePlugin(*templateType, fs.Arg(0), *goPath, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitCode(classify(exitEnvironment, err)))
+	}
+	if problems > 0 {
+		os.Exit(exitSignature)
+	}
+}
+
+// validatePlugin 依次检查语法、插件签名、插件源码与包装文件的类型，将发现的问题写入out，返回问题数。
+// 前一步有问题时不进行后面的检查
+func validatePlugin(templateType, pluginPath, goPath string, out io.Writer) (int, error) {
+	isFile, err := IsFile(pluginPath)
+	if err != nil {
+		return 0, classify(exitUsage, err)
+	}
+	if !isFile { // 如果路径是目录，则采用目录下的plugin.go文件
+		pluginPath = filepath.Join(pluginPath, "plugin.go")
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, pluginPath, nil, parser.AllErrors|parser.ParseComments)
+	if err != nil {
+		var list scanner.ErrorList
+		if !errors.As(err, &list) {
+			return 0, err
+		}
+		for _, e := range list {
+			fmt.Fprintln(out, e)
+		}
+		return len(list), nil
+	}
+	files := []*ast.File{file}
+	if !isFile { // 包模式：目录下的其他文件与插件文件属于同一个包
+		goFiles, _, err := packageSources(filepath.Dir(pluginPath), "")
+		if err != nil {
+			return 0, err
+		}
+		problems := 0
+		for _, name := range goFiles {
+			if name == filepath.Base(pluginPath) {
+				continue
+			}
+			f, err := parser.ParseFile(fset, filepath.Join(filepath.Dir(pluginPath), name), nil, parser.AllErrors)
+			if err != nil {
+				var list scanner.ErrorList
+				if !errors.As(err, &list) {
+					return 0, err
+				}
+				for _, e := range list {
+					fmt.Fprintln(out, e)
+				}
+				problems += len(list)
+			}
+			files = append(files, f)
+		}
+		if problems > 0 {
+			return problems, nil
+		}
+	}
+	src, err := parsePlugin(pluginPath, templateType)
+	if err != nil {
+		fmt.Fprintf(out, "%s: %v\n", pluginPath, err)
+		return 1, nil
+	}
+	src.Package = !isFile
+	resolveImportNames(goPath, filepath.Dir(pluginPath), nil, nil, src)
+	wrapped, err := wrapPlugin(src)
+	if err != nil {
+		return 0, err
+	}
+	// 包装文件只存在于内存中
+	wrappedPath := filepath.Join(filepath.Dir(pluginPath), "wrappedPlugin.go")
+	wrappedFile, err := parser.ParseFile(fset, wrappedPath, wrapped, parser.AllErrors)
+	if err != nil {
+		fmt.Fprintf(out, "generated wrapper: %v\n", err)
+		return 1, nil
+	}
+	exports, err := listExports(goPath, filepath.Dir(pluginPath), append(files, wrappedFile)...)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1, nil
+	}
+	imp := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if export, ok := exports[path]; ok && export != "" {
+			return os.Open(export)
+		}
+		return nil, fmt.Errorf("no export data for %s", path)
+	})
+	// 先单独检查插件源码，使错误位置对应插件文件中的行号
+	if problems := typeCheck(fset, imp, out, files...); problems > 0 {
+		return problems, nil
+	}
+	// 插件源码没有问题时，包装文件中的错误通常是插件中的名字与包装模板冲突。
+	// 文件模式的包装文件内联了插件源码，包模式则与插件的包一起检查
+	if src.Package {
+		return typeCheck(fset, imp, out, append(files, wrappedFile)...), nil
+	}
+	return typeCheck(fset, imp, out, wrappedFile), nil
+}
+
+// 在插件所在的模块中运行go list -export，编译files引用的包（不链接），返回import路径到导出数据文件的映射
+func listExports(goPath, dir string, files ...*ast.File) (map[string]string, error) {
+	args := []string{"list", "-export", "-deps", "-f", "{{.ImportPath}} {{.Export}}"}
+	for _, file := range files {
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			if path != "C" && path != "unsafe" {
+				args = append(args, path)
+			}
+		}
+	}
+	cmd := exec.Command(goPath, args...)
+	cmd.Dir = dir
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, goCommandError("loading imported packages", err, stderr.Bytes())
+	}
+	exports := make(map[string]string)
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		fields := strings.SplitN(lines.Text(), " ", 2)
+		if len(fields) == 2 {
+			exports[fields[0]] = fields[1]
+		}
+	}
+	return exports, nil
+}
+
+// 将files作为一个包做类型检查，import "C"视为合法
+func typeCheck(fset *token.FileSet, imp types.Importer, out io.Writer, files ...*ast.File) int {
+	problems := 0
+	conf := types.Config{
+		Importer:    imp,
+		FakeImportC: true,
+		Error: func(err error) {
+			fmt.Fprintln(out, err)
+			problems++
+		},
+	}
+	conf.Check("main", fset, files, nil)
+	return problems
+}
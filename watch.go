@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildCycle 构建一次插件，testOpt不为nil时构建成功后运行用例，向out输出一行结果，失败时在其后输出详细信息。
+// 用例不通过时返回的错误归为exitFailure
+func buildCycle(opt *buildOptions, testOpt *testOptions, out io.Writer) error {
+	start := time.Now()
+	log := bytes.Buffer{}
+	line := fmt.Sprintf("[%s] ", start.Format("15:04:05"))
+	result, err := buildPlugin(opt, &log)
+	if err != nil {
+		fmt.Fprintf(out, "%sFAIL build: %v\n%s", line, err, log.String())
+		return err
+	}
+	cached := ""
+	if result.Cached {
+		cached = ", cached"
+	}
+	line += fmt.Sprintf("ok   build %s (%.1fs%s)", opt.outputName(), time.Since(start).Seconds(), cached)
+	if testOpt == nil {
+		fmt.Fprintln(out, line)
+		return nil
+	}
+	log.Reset()
+	end := opt.Events.stage(opt, "test")
+	passed, failed, err := testPlugin(testOpt, &log)
+	switch {
+	case err != nil:
+		fmt.Fprintf(out, "%s, FAIL test: %v\n", line, err)
+		return end(classify(exitFailure, err), "")
+	case failed > 0:
+		fmt.Fprintf(out, "%s, FAIL test: %d passed, %d failed\n%s", line, passed, failed, log.String())
+		opt.Events.emit(&buildEvent{Event: "test", Plugin: opt.PluginPath, Passed: passed, Failed: failed})
+		return end(&builderError{Code: exitFailure, Err: fmt.Errorf("%d of %d fixtures failed", failed, passed+failed)}, "")
+	}
+	fmt.Fprintf(out, "%s, ok test: %d passed\n", line, passed)
+	opt.Events.emit(&buildEvent{Event: "test", Plugin: opt.PluginPath, Passed: passed})
+	end(nil, "ok")
+	return nil
+}
+
+// watchPlugin 轮询插件所在目录、用例目录与插件依赖的主模块及本地replace模块（如fuzzTypes SDK）中的包，
+// 文件变化并稳定interval之后重新构建，每次构建后重新列出依赖。不会返回，除非无法读取插件目录
+func watchPlugin(opt *buildOptions, testOpt *testOptions, interval time.Duration, out io.Writer) error {
+	pluginPath, err := opt.pluginFile()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(pluginPath)
+	trees := []string{dir}
+	if testOpt != nil && testOpt.FixturesDir != "" {
+		trees = append(trees, testOpt.FixturesDir)
+	}
+	deps, err := watchDirs(opt, dir, trees)
+	if err != nil {
+		fmt.Fprintf(out, "cannot list dependencies, watching the plugin directory only: %v\n", err)
+	}
+	snapshot, err := watchSnapshot(trees, deps)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "watching %s and %d dependency directories, press Ctrl+C to stop\n", dir, len(deps))
+	buildCycle(opt, testOpt, out)
+	for {
+		time.Sleep(interval)
+		current, err := watchSnapshot(trees, deps)
+		if err != nil {
+			return err
+		}
+		if current == snapshot {
+			continue
+		}
+		// 等待文件不再变化，避免编辑器分多次写入时重复构建
+		for {
+			snapshot = current
+			time.Sleep(interval)
+			if current, err = watchSnapshot(trees, deps); err != nil {
+				return err
+			}
+			if current == snapshot {
+				break
+			}
+		}
+		buildCycle(opt, testOpt, out)
+		// 插件可能引入了新的包，无法列出时（如插件有语法错误）沿用之前的目录
+		if listed, err := watchDirs(opt, dir, trees); err == nil {
+			deps = listed
+		}
+		if snapshot, err = watchSnapshot(trees, deps); err != nil {
+			return err
+		}
+	}
+}
+
+// 插件依赖的包中需要监视的目录：主模块与本地replace的模块中的包目录及其go.mod所在目录，
+// 不包括GOROOT与模块缓存中的包，也不包括已经递归监视的trees中的目录
+func watchDirs(opt *buildOptions, dir string, trees []string) ([]string, error) {
+	values, err := goEnv(opt, dir, "GOROOT", "GOMODCACHE", "GOWORK")
+	if err != nil {
+		return nil, err
+	}
+	format := `{{if not .Standard}}{{.Dir}}{{with .Module}}{{"\n"}}{{.GoMod}}{{end}}{{end}}`
+	args := append([]string{"list", "-e", "-deps"}, opt.modFlags()...)
+	list := exec.Command(opt.GoPath, append(args, "-f", format, ".")...)
+	list.Dir = dir
+	list.Env = opt.buildEnv()
+	stderr := bytes.Buffer{}
+	list.Stderr = &stderr
+	output, err := list.Output()
+	if err != nil {
+		return nil, goCommandError("go list", err, stderr.Bytes())
+	}
+	paths := strings.Split(string(output), "\n")
+	if gowork := values["GOWORK"]; gowork != "" && gowork != "off" {
+		paths = append(paths, gowork)
+	}
+	dirs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if ext := filepath.Ext(path); ext == ".mod" || ext == ".work" {
+			path = filepath.Dir(path) // go.mod与go.work监视其所在目录
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		skip := false
+		for _, root := range append([]string{values["GOROOT"], values["GOMODCACHE"]}, trees...) {
+			if root != "" && isSubPath(root, path) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			dirs = append(dirs, path)
+		}
+	}
+	return dirs, nil
+}
+
+// 与构建有关的文件：Go源文件、cgo与汇编等源文件、go.mod、go.sum、go.work与用例
+var watchedExts = map[string]bool{".go": true, ".json": true, ".s": true, ".S": true, ".sx": true, ".c": true,
+	".h": true, ".cc": true, ".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true, ".m": true,
+	".f": true, ".F": true, ".for": true, ".f90": true, ".syso": true}
+
+// 记录trees（递归）与dirs（只包括目录本身）中与构建有关的文件的路径、大小与修改时间
+func watchSnapshot(trees, dirs []string) (string, error) {
+	sb := strings.Builder{}
+	record := func(path string, info os.FileInfo) {
+		name := info.Name()
+		if name == "wrappedPlugin.go" { // 构建时生成
+			return
+		}
+		if watchedExts[filepath.Ext(name)] || name == "go.mod" || name == "go.sum" || name == "go.work" || name == "go.work.sum" {
+			fmt.Fprintf(&sb, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	for _, dir := range trees {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) { // 文件在遍历过程中被删除
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				// 跳过隐藏目录与builder test的临时目录
+				if path != dir && (strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "fuzzgiuharness")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			record(path, info)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) { // 依赖的目录被删除，下次构建后重新列出
+				continue
+			}
+			return "", err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if info, err := entry.Info(); err == nil { // 出错时文件已被删除
+				record(filepath.Join(dir, entry.Name()), info)
+			}
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pluginSource 解析后的插件源文件
+type pluginSource struct {
+	TemplateType string
+	FunName      string
+	Path         string
+	Imports      []string
+	ImportNames  map[string]string // 没有别名的import的路径到包名，见resolveImportNames
+	Code         string
+	AllParams    []Param // 插件函数的完整参数列表
+	Params       []Param // 自定义参数（去除了固定参数）
+	Concurrency  int     // 同时进入插件函数的最大调用数，0表示不限制
+	// 以下字段仅在实例模式下有效
+	Instance     bool
+	InstanceType string       // 构造函数返回的类型，如 *MyReactor
+	CtorParams   []Param      // 构造函数的参数列表
+	Repro        *reproInputs // 可复现构建的输入摘要，写入元数据
+	FuzzTypes    string       // 插件引用的fuzzTypes SDK的SchemaVersion，写入元数据
+	// 包模式：go build编译插件所在目录的整个包，包装文件不内联插件源码，插件可以拆分为多个文件
+	Package bool
+}
+
+// 根据插件类型获取插件函数名，插件类型由templates/abi.json定义
+func getPluginFunName(templateType string) string {
+	if p := abi.plugin(templateType); p != nil {
+		return p.Function
+	}
+	return ""
+}
+
+// 实例模式下插件的构造函数名，构造函数返回结构体指针，结构体需实现与插件函数同名的方法
+func getConstructorName(templateType string) string {
+	if p := abi.plugin(templateType); p != nil {
+		return p.Constructor
+	}
+	return ""
+}
+
+// 模板文件名，格式为tmpl+首字母大写的插件类型(+Instance)+.gotmp，在当前目录的templates子目录下
+func getTemplateFileName(templateType string, instance bool) string {
+	name := "templates/" + "tmpl" + strings.ToUpper(templateType[:1]) + templateType[1:]
+	if instance {
+		name += "Instance"
+	}
+	return name + ".gotmp"
+}
+
+// 判断插件函数参数列表的函数签名是否符合templates/abi.json中的定义，返回删去固定参数后的自定义参数列表。
+// aliases为插件文件中import的别名到包名，如 ft "FuzzGIUPluginBuilder/fuzzTypes" 中的*ft.Req按*fuzzTypes.Req比较
+func checkSignature(templateType string, params []Param, retType string, aliases map[string]string) ([]Param, error) {
+	p := abi.plugin(templateType)
+	if p == nil {
+		return nil, fmt.Errorf("unsupported template type: %s", templateType)
+	}
+	ok := len(params) >= len(p.Inputs) && unaliasType(retType, aliases) == p.Result.Type
+	for i := 0; ok && i < len(p.Inputs); i++ {
+		ok = params[i].Name == p.Inputs[i].Param && unaliasType(params[i].Type, aliases) == p.Inputs[i].Type
+	}
+	if !ok {
+		return nil, errors.New("bad function definition, example: " + p.signature())
+	}
+	return params[len(p.Inputs):], nil
+}
+
+// parsePlugin 解析插件文件，检查插件函数签名。
+// 文件中没有插件函数时，查找构造函数（如NewReactor），以实例模式解析构造函数返回类型上的同名方法
+func parsePlugin(path, templateType string) (*pluginSource, error) {
+	funName := getPluginFunName(templateType)
+	if funName == "" {
+		return nil, fmt.Errorf("unsupported template type: %s", templateType)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.AllErrors|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	src := &pluginSource{TemplateType: templateType, FunName: funName, Path: path}
+	if src.Imports, err = getImports(path); err != nil {
+		return nil, err
+	}
+	if src.Code, err = GetCodes(path); err != nil { // 获取文件中的源码部分（import之后开始的部分）
+		return nil, err
+	}
+	if src.Concurrency, err = getConcurrencyDirective(file); err != nil {
+		return nil, err
+	}
+	fn := findFuncDecl(file, funName, "")
+	if fn == nil {
+		ctorName := getConstructorName(templateType)
+		ctor := findFuncDecl(file, ctorName, "")
+		if ctor == nil {
+			return nil, fmt.Errorf("neither function %s nor constructor %s found in %s", funName, ctorName, path)
+		}
+		typeName, err := getConstructedType(ctor)
+		if err != nil {
+			return nil, err
+		}
+		if fn = findFuncDecl(file, funName, typeName); fn == nil {
+			return nil, fmt.Errorf("method %s of type %s not found in %s", funName, typeName, path)
+		}
+		src.Instance = true
+		src.InstanceType = "*" + typeName
+		src.CtorParams = getDeclParams(ctor)
+	}
+	src.AllParams = getDeclParams(fn)
+	src.Params, err = checkSignature(templateType, src.AllParams, getReturnType(fn), importAliases(src.Imports))
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// 获取构造函数返回的结构体类型名，构造函数必须只返回一个 *T
+func getConstructedType(ctor *ast.FuncDecl) (string, error) {
+	results := ctor.Type.Results
+	if results != nil && len(results.List) == 1 && len(results.List[0].Names) <= 1 {
+		if star, ok := results.List[0].Type.(*ast.StarExpr); ok {
+			if ident, ok := star.X.(*ast.Ident); ok {
+				return ident.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("bad constructor definition, example: %s({custom arguments}) *MyPlugin",
+		ctor.Name.Name)
+}
+
+// 拼接形参与实参字符串
+func joinParams(params []Param) (formal, actual string) {
+	for i, param := range params {
+		formal += fmt.Sprintf("%s %s", param.Name, param.Type)
+		actual += param.Name
+		if i != len(params)-1 {
+			formal += ", "
+			actual += ", "
+		}
+	}
+	return
+}
+
+// wrapPlugin 将插件源码填入对应类型的模板，生成可以c-shared方式编译的包装文件
+func wrapPlugin(src *pluginSource) ([]byte, error) {
+	tmplFileName := getTemplateFileName(src.TemplateType, src.Instance)
+	tmplImports, err := getImports(tmplFileName)
+	if err != nil {
+		return nil, err
+	}
+	// 去除插件go文件中与模板文件重合的import
+	dedupImports := "import (\n"
+	for _, pImport := range src.Imports {
+		if !importedBy(pImport, tmplImports, src.ImportNames) {
+			dedupImports += fmt.Sprintf("\t%s\n", pImport)
+		}
+	}
+	tmpl, err := os.ReadFile(tmplFileName)
+	if err != nil {
+		return nil, err
+	}
+	formalParamsStr, actualParamsStr := joinParams(src.Params)
+	// 将模板文件与插件文件合并
+	tmpl = bytes.Replace(tmpl, []byte("/* FORMAL PARAMETERS */"), []byte(formalParamsStr), -1)
+	tmpl = bytes.Replace(tmpl, []byte("/* ACTUAL PARAMETERS */"), []byte(actualParamsStr), -1)
+	if src.Instance {
+		ctorFormal, ctorActual := joinParams(src.CtorParams)
+		tmpl = bytes.Replace(tmpl, []byte("/* CONSTRUCTOR FORMAL PARAMETERS */"), []byte(ctorFormal), -1)
+		tmpl = bytes.Replace(tmpl, []byte("/* CONSTRUCTOR ACTUAL PARAMETERS */"), []byte(ctorActual), -1)
+		tmpl = bytes.Replace(tmpl, []byte("/* INSTANCE TYPE */"),
+			[]byte("type pluginInstance = "+src.InstanceType), -1)
+	}
+	guard, acquire := "", ""
+	if src.Concurrency > 0 { // 用带缓冲的channel限制同时进入插件函数的调用数
+		guard = fmt.Sprintf("// 同时最多%d个调用进入插件函数\nvar callGuard = make(chan struct{}, %d)",
+			src.Concurrency, src.Concurrency)
+		acquire = "callGuard <- struct{}{}\n\tdefer func() { <-callGuard }()"
+	}
+	tmpl = bytes.Replace(tmpl, []byte("/* CONCURRENCY GUARD */"), []byte(guard), -1)
+	tmpl = bytes.Replace(tmpl, []byte("/* ACQUIRE GUARD */"), []byte(acquire), -1)
+	meta, err := json.Marshal(newPluginMeta(src))
+	if err != nil {
+		return nil, err
+	}
+	tmpl = bytes.Replace(tmpl, []byte(`"/* PLUGIN METADATA */"`), []byte(strconv.Quote(string(meta))), -1)
+	// 插件以别名引入的包（如 ft "FuzzGIUPluginBuilder/fuzzTypes"），模板按包名使用时另外引入
+	dedupImports += getRenamedImports(src.Imports, src.ImportNames, tmpl) + ")"
+	code := src.Code
+	if src.Package { // 插件源码与包装文件位于同一个包中，包装文件只引入自身用到的包
+		code, dedupImports = "", getUsedImports(src.Imports, src.ImportNames, tmplImports, tmpl)
+	}
+	tmpl = bytes.Replace(tmpl, []byte("/* CODE */"), []byte(code), -1)
+	tmpl = bytes.Replace(tmpl, []byte("/* CUSTOM IMPORTS */"), []byte(dedupImports), -1)
+	return tmpl, nil
+}
+
+// 返回插件的import中被包装文件（如参数类型、fuzzTypes）引用到的包，已由模板引入的包除外
+func getUsedImports(imports []string, names map[string]string, tmplImports []string, wrapper []byte) string {
+	ret := "import (\n"
+	for _, imp := range imports {
+		if !importedBy(imp, tmplImports, names) && usesPackage(wrapper, importName(imp, names)) {
+			ret += fmt.Sprintf("\t%s\n", imp)
+		}
+	}
+	return ret + getRenamedImports(imports, names, wrapper) + ")"
+}
+
+// 插件以别名引入、包装文件却以包名引用的包（如 ft "FuzzGIUPluginBuilder/fuzzTypes" 与模板中的fuzzTypes.Req），
+// 以不带别名的import另外引入。插件中已有同名的import时不重复引入
+func getRenamedImports(imports []string, names map[string]string, wrapper []byte) string {
+	declared := make(map[string]bool)
+	for _, imp := range imports {
+		declared[importName(imp, names)] = true
+	}
+	ret := ""
+	for _, imp := range imports {
+		fields := strings.Fields(imp)
+		if len(fields) != 2 {
+			continue
+		}
+		pkgName := packageName(importPath(imp), names)
+		if !declared[pkgName] && usesPackage(wrapper, pkgName) {
+			declared[pkgName] = true
+			ret += fmt.Sprintf("\t%s\n", fields[1])
+		}
+	}
+	return ret
+}
+
+// 模板是否已经以同样的名字引入了imp的包，如插件中的 json "encoding/json" 与模板中的"encoding/json"。
+// 别名不同时两者都需要，插件的import保留
+func importedBy(imp string, tmplImports []string, names map[string]string) bool {
+	for _, tImport := range tmplImports {
+		if importPath(imp) == importPath(tImport) && importName(imp, names) == importName(tImport, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// 插件文件中import的别名到包名（导入路径的最后一段），不包括_与.
+func importAliases(imports []string) map[string]string {
+	aliases := make(map[string]string)
+	for _, imp := range imports {
+		if fields := strings.Fields(imp); len(fields) == 2 && fields[0] != "_" && fields[0] != "." {
+			aliases[fields[0]] = path.Base(importPath(imp))
+		}
+	}
+	return aliases
+}
+
+// 将类型中以别名限定的包名替换为包名，如*ft.Req替换为*fuzzTypes.Req
+var qualifierRe = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+func unaliasType(typ string, aliases map[string]string) string {
+	return qualifierRe.ReplaceAllStringFunc(typ, func(q string) string {
+		if name, ok := aliases[strings.TrimSuffix(q, ".")]; ok {
+			return name + "."
+		}
+		return q
+	})
+}
+
+// 代码中是否以name.的形式引用了包
+func usesPackage(code []byte, name string) bool {
+	if name == "_" || name == "." {
+		return false
+	}
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\.`).Match(code)
+}
+
+// import语句中的导入路径（去掉别名与引号）
+func importPath(imp string) string {
+	fields := strings.Fields(imp)
+	p, _ := strconv.Unquote(fields[len(fields)-1])
+	return p
+}
+
+// import语句在插件文件中引入的名字：有别名时为别名，否则为包名
+func importName(imp string, names map[string]string) string {
+	if fields := strings.Fields(imp); len(fields) == 2 {
+		return fields[0]
+	}
+	return packageName(importPath(imp), names)
+}
+
+// 导入路径对应的包名，取go list解析出的包名，没有时取导入路径的最后一段
+func packageName(importPath string, names map[string]string) string {
+	if name, ok := names[importPath]; ok {
+		return name
+	}
+	return path.Base(importPath)
+}
+
+// resolveImportNames 以go list解析插件中没有别名的import的包名，包名可能与导入路径的最后一段不同
+// （如.../v2、gopkg.in/yaml.v3），结果写入src.ImportNames。无法解析的包由编译阶段报告
+func resolveImportNames(goPath, dir string, env, modFlags []string, src *pluginSource) {
+	paths := make([]string, 0)
+	for _, imp := range src.Imports {
+		if len(strings.Fields(imp)) == 1 {
+			paths = append(paths, importPath(imp))
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	args := append([]string{"list", "-e"}, modFlags...)
+	cmd := exec.Command(goPath, append(append(args, "-f", "{{.ImportPath}}\t{{.Name}}"), paths...)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	src.ImportNames = make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.SplitN(line, "\t", 2); len(fields) == 2 && fields[1] != "" {
+			src.ImportNames[fields[0]] = fields[1]
+		}
+	}
+}
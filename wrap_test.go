@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 写入临时目录中的插件文件
+func writePlugin(t *testing.T, code string) string {
+	path := filepath.Join(t.TempDir(), "plugin.go")
+	if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckSignatureAliasedImport(t *testing.T) {
+	path := writePlugin(t, `package main
+
+import (
+	ft "FuzzGIUPluginBuilder/fuzzTypes"
+	json "encoding/json"
+	js "encoding/json"
+)
+
+func React(request *ft.Req, resp *ft.Resp, keyword string) *ft.Reaction {
+	json.Valid(nil)
+	js.Valid(nil)
+	return new(ft.Reaction)
+}
+`)
+	src, err := parsePlugin(path, "reactor")
+	if err != nil {
+		t.Fatalf("parsePlugin: %v", err)
+	}
+	if len(src.Params) != 1 || src.Params[0].Type != "string" {
+		t.Errorf("custom params = %+v, want [keyword string]", src.Params)
+	}
+	wrapped, err := wrapPlugin(src)
+	if err != nil {
+		t.Fatalf("wrapPlugin: %v", err)
+	}
+	for imp, want := range map[string]int{
+		`ft "FuzzGIUPluginBuilder/fuzzTypes"`:  1, // 插件代码使用的别名
+		"\t\"FuzzGIUPluginBuilder/fuzzTypes\"": 1, // 模板按包名使用
+		`json "encoding/json"`:                 0, // 与模板的"encoding/json"相同
+		`js "encoding/json"`:                   1, // 别名不同，保留
+		`"encoding/json"`:                      2,
+	} {
+		if got := strings.Count(string(wrapped), imp); got != want {
+			t.Errorf("wrapper imports %s %d times, want %d", imp, got, want)
+		}
+	}
+}
+
+func TestCheckSignatureAliasMismatch(t *testing.T) {
+	path := writePlugin(t, `package main
+
+import ft "FuzzGIUPluginBuilder/fuzzTypes"
+
+func React(request *ft.Req, resp *ft.Req) *ft.Reaction {
+	return nil
+}
+`)
+	if _, err := parsePlugin(path, "reactor"); err == nil || !strings.Contains(err.Error(), "bad function definition") {
+		t.Errorf("parsePlugin error = %v, want a bad function definition", err)
+	}
+}
+
+func TestUnaliasType(t *testing.T) {
+	aliases := map[string]string{"ft": "fuzzTypes", "h": "http"}
+	for typ, want := range map[string]string{
+		"*ft.Req":          "*fuzzTypes.Req",
+		"map[string]*ft.X": "map[string]*fuzzTypes.X",
+		"[]h.Header":       "[]http.Header",
+		"*fuzzTypes.Req":   "*fuzzTypes.Req",
+		"string":           "string",
+		"*left.Req":        "*left.Req",
+	} {
+		if got := unaliasType(typ, aliases); got != want {
+			t.Errorf("unaliasType(%q) = %q, want %q", typ, got, want)
+		}
+	}
+}